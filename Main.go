@@ -1,13 +1,19 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/ricardoaat/bioschemas-gocrawlit/crawler"
+	"github.com/ricardoaat/bioschemas-gocrawlit/v2/crawler"
 	"github.com/rifflock/lfshook"
 	log "github.com/sirupsen/logrus"
 )
@@ -17,11 +23,24 @@ var (
 	buildDate string
 )
 
-func logInit(d bool) {
+// sinkFlags collects the repeatable -sink flag.
+type sinkFlags []string
+
+func (s *sinkFlags) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *sinkFlags) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// logInit logs to out and to the log file.
+func logInit(d bool, out io.Writer) {
 
 	logfile := "biocrawlit.log"
-	fmt.Println("Loging to " + logfile)
-	log.SetOutput(os.Stdout)
+	fmt.Fprintln(out, "Loging to "+logfile)
+	log.SetOutput(out)
 	if d {
 		log.SetLevel(log.DebugLevel)
 	} else {
@@ -42,9 +61,161 @@ func logInit(d bool) {
 	))
 }
 
+// propertyFlags collects the repeatable -prop flag of the search command.
+type propertyFlags map[string]string
+
+func (p propertyFlags) String() string {
+	var s []string
+	for k, v := range p {
+		s = append(s, k+"="+v)
+	}
+	return strings.Join(s, " ")
+}
+
+func (p propertyFlags) Set(v string) error {
+	kv := strings.SplitN(v, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("expecting property=value, got %q", v)
+	}
+	p[kv[0]] = kv[1]
+	return nil
+}
+
+// search queries the local search index built by the bleve sink.
+func search(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	index := fs.String("index", crawler.DefaultSearchIndex, "Search index path")
+	types := fs.String("type", "", "Comma separated @type of the entities, e.g. Dataset,DataCatalog")
+	n := fs.Int("n", 10, "Max number of results")
+	j := fs.Bool("json", false, "Print the results as JSON lines")
+	props := propertyFlags{}
+	fs.Var(props, "prop", "Property filter as path=phrase, e.g. creator.name=Jane. Can be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: bioschemas-gocrawlit search [options] [free text]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	log.SetOutput(os.Stderr)
+
+	q := crawler.SearchQuery{
+		Text:       strings.Join(fs.Args(), " "),
+		Properties: props,
+		Size:       *n,
+	}
+	if *types != "" {
+		q.Types = crawler.SplitList(*types)
+	}
+
+	results, total, err := crawler.Search(*index, q)
+	if err != nil {
+		log.Error("Error searching ", *index, " ", err)
+		os.Exit(1)
+	}
+
+	for _, r := range results {
+		if *j {
+			b, err := json.Marshal(r)
+			if err != nil {
+				log.Error("Error marshalling result ", err)
+				continue
+			}
+			fmt.Println(string(b))
+			continue
+		}
+
+		name, _ := r.Data["name"].(string)
+		fmt.Printf("%.3f\t%s\t%s\t%s\n", r.Score, strings.Join(r.Types, ","), r.ID, name)
+		fmt.Printf("\tpage: %s\n", r.Page)
+		if len(r.Pages) > 0 {
+			fmt.Printf("\tpages: %s\n", strings.Join(r.Pages, " "))
+		}
+		if r.Source != "" {
+			fmt.Printf("\tsource: %s\n", r.Source)
+		}
+	}
+	if !*j {
+		fmt.Printf("%d of %d entities\n", len(results), total)
+	}
+}
+
+// export writes the entities of JSON lines outputs as CSV or TSV tables,
+// e.g. the parts of a rotated output.
+func export(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := fs.String("dir", ".", "Output directory")
+	prefix := fs.String("prefix", "", "Prefix of the table file names. Default the first input file name")
+	format := fs.String("format", crawler.FormatCSV, "Table format, csv or tsv")
+	columns := fs.String("columns", "", "Comma separated columns, e.g. page,name,identifier,license,keywords. Default every property")
+	types := fs.String("type", "", "Comma separated @type of the tables to write, e.g. Dataset,DataCatalog. Default all")
+	join := fs.String("join", crawler.DefaultJoin, "Separator of the values of multi-valued columns")
+	exists := fs.String("exists", crawler.ExistsTimestamp, "What to do with existing tables: timestamp the new ones, refuse or overwrite")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: bioschemas-gocrawlit export [options] file.jsonl [file.1.jsonl ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	log.SetOutput(os.Stderr)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *format != crawler.FormatCSV && *format != crawler.FormatTSV {
+		log.Error("Unknown table format ", *format)
+		os.Exit(2)
+	}
+	if *exists != crawler.ExistsTimestamp && *exists != crawler.ExistsRefuse && *exists != crawler.ExistsOverwrite {
+		log.Error("Unknown exists policy ", *exists)
+		os.Exit(2)
+	}
+
+	if *prefix == "" {
+		in := filepath.Base(fs.Arg(0))
+		for _, ext := range []string{".gz", ".zst"} {
+			in = strings.TrimSuffix(in, ext)
+		}
+		*prefix = strings.TrimSuffix(in, filepath.Ext(in)) + "_"
+	}
+	s := crawler.NewTableSink(*dir, *prefix, *format)
+	s.Join = *join
+	s.Exists = *exists
+	if *columns != "" {
+		s.Columns = crawler.SplitList(*columns)
+	}
+	if *types != "" {
+		s.Types = crawler.SplitList(*types)
+	}
+
+	if err := s.Open(); err != nil {
+		log.Error("Error opening tables ", err)
+		os.Exit(1)
+	}
+	if err := crawler.ReadJSONLFiles(fs.Args(), s.Write); err != nil {
+		log.Error("Error reading ", err)
+		os.Exit(1)
+	}
+	if err := s.Close(); err != nil {
+		log.Error("Error writing tables ", err)
+		os.Exit(1)
+	}
+}
+
 func main() {
 
-	e := flag.Bool("e", false, "Connects to an elastisearch server on http://127.0.0.1:9200")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "search":
+			search(os.Args[2:])
+			return
+		case "export":
+			export(os.Args[2:])
+			return
+		}
+	}
+
+	e := flag.Bool("e", false, "Indexes the crawled data on the Elasticsearch server at http://127.0.0.1:9200, same as -sink elastic. Use -sink elastic:url=...,index=... for another server or index, -e is then not needed")
 	d := flag.Bool("d", false, "Sets up the log level to debug")
 	v := flag.Bool("v", false, "Returns the binary version and built date info")
 	q := flag.Bool("q", false, "Skip queries on the URL.")
@@ -52,10 +223,33 @@ func main() {
 	m := flag.Int("m", 0, "Max number of recursion depth of visited URLs")
 	p := flag.Bool("p", false, "Stay on current path.")
 	qr := flag.String("query", "", "Pagination query word")
+	hd := flag.Bool("head", false, "Check the content type with a HEAD request before fetching a URL")
+	ms := flag.Int("maxsize", 0, "Max size in bytes of fetched documents. Default 10MB")
+	ng := flag.Bool("negotiate", false, "Request RDF and JSON-LD representations of each page through content negotiation")
+	o := flag.String("o", crawler.DefaultOutputTemplate, "Output file name template, with the {host}, {path}, {date} and {time} placeholders. The other sinks name their files after it")
+	so := flag.Bool("stdout", false, "Write the records as JSON lines to stdout instead of the output file, logging to stderr. Same as -sink jsonl:file=-")
+	rt := flag.String("routes", "", "JSON file of named sinks and the routes dispatching entities to them by type, host, URL or validation result")
+	it := flag.String("types", "", "Comma separated @types of the entities to keep, subclasses included, e.g. Dataset,Event")
+	et := flag.String("exclude-types", "", "Comma separated @types of the entities to drop, subclasses included, e.g. Organization,WebSite")
+	pr := flag.String("properties", "", "Comma separated property paths to keep on the entities, e.g. name,identifier,creator.name")
+	dd := flag.String("dedupe", "", "Comma separated @types of the entities to write once with the pages they were found on, each one optionally followed by :id, :hash or :auto, e.g. Organization,WebSite:hash. * for every type")
+	var sinks sinkFlags
+	flag.Var(&sinks, "sink", fmt.Sprintf("Output sink as name[:key=value,...], can be repeated. Available: %s. Default jsonl", strings.Join(crawler.SinkNames(), ", ")))
 
 	flag.Parse()
 
-	logInit(*d)
+	if *so {
+		sinks = append(sinks, "jsonl:file="+crawler.Stdout)
+	}
+
+	// Keep stdout for the records when they are written to it
+	var logOut io.Writer = os.Stdout
+	for _, spec := range sinks {
+		if _, params, err := crawler.ParseSinkSpec(spec); err == nil && params["file"] == crawler.Stdout {
+			logOut = os.Stderr
+		}
+	}
+	logInit(*d, logOut)
 
 	log.Info("--------------Init program--------------")
 	log.Info(fmt.Sprintf("Version: %s Build Date: %s", version, buildDate))
@@ -76,7 +270,7 @@ func main() {
 		nq := baseURL
 		nq.RawQuery = ""
 
-		f := fmt.Sprintf("%s%sschema.json", baseURL.Host, strings.Replace(baseURL.Path, "/", "_", -1))
+		f := crawler.OutputName(*o, baseURL, time.Now())
 
 		filter := ""
 		if *p {
@@ -88,7 +282,6 @@ func main() {
 		ad = append(ad, fmt.Sprintf("www.%s", baseURL.Host))
 
 		c := crawler.Crawler{
-			UseElastic:     *e,
 			Index:          baseURL.Host,
 			OutputFileName: f,
 			BaseURL:        baseURL,
@@ -97,22 +290,79 @@ func main() {
 			AllowedDomains: ad,
 			Filter:         filter,
 			QueryWord:      *qr,
+			CheckHead:      *hd,
+			MaxBodySize:    *ms,
+			Negotiate:      *ng,
+		}
+		if *it != "" {
+			c.IncludeTypes = crawler.SplitList(*it)
+		}
+		if *et != "" {
+			c.ExcludeTypes = crawler.SplitList(*et)
+		}
+		if *pr != "" {
+			c.Properties = crawler.SplitList(*pr)
+		}
+		if c.Dedupe, err = crawler.ParseDedupe(*dd); err != nil {
+			log.Error("Error parsing -dedupe ", err)
+			os.Exit(1)
 		}
 
-		c.Init()
+		if len(sinks) == 0 && *rt == "" {
+			sinks = append(sinks, "jsonl")
+		}
+		if *e && !hasSink(sinks, "elastic") {
+			sinks = append(sinks, "elastic")
+		}
 
-		if *e {
-			if err := c.ElasticInit(); err != nil {
-				log.Error("Error initializing elastic function ")
+		for _, spec := range sinks {
+			name, params, err := crawler.ParseSinkSpec(spec)
+			if err != nil {
+				log.Error("Error parsing sink ", err)
+				os.Exit(1)
 			}
+			s, err := crawler.NewSink(name, &c, params)
+			if err != nil {
+				log.Error("Error creating sink ", err)
+				os.Exit(1)
+			}
+			c.AddSink(s)
 		}
 
-		c.Start()
+		if *rt != "" {
+			r, err := crawler.LoadRoutes(*rt, &c)
+			if err != nil {
+				log.Error("Error loading routes ", err)
+				os.Exit(1)
+			}
+			c.AddSink(r)
+		}
+
+		c.Init()
+
+		// Flush what has been extracted so far when interrupted
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			log.Warn("Interrupted, flushing sinks")
+			c.Close()
+			os.Exit(1)
+		}()
 
-		// err = c.ToJSONfile()
-		// if err != nil {
-		// 	log.Error("ToJSONfile error ", err)
-		// }
+		if err := c.Start(); err != nil {
+			log.Error("Crawl not started ", err)
+			os.Exit(1)
+		}
+	}
+}
 
+// hasSink tells whether a sink of the given name is in the -sink flags.
+func hasSink(sinks sinkFlags, name string) bool {
+	for _, spec := range sinks {
+		if n, _, err := crawler.ParseSinkSpec(spec); err == nil && n == name {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,402 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gocolly/colly"
+	log "github.com/sirupsen/logrus"
+)
+
+type contentKind int
+
+const (
+	contentUnknown contentKind = iota
+	contentHTML
+	contentXML
+	contentJSONLD
+	contentJSON
+	contentRDF
+	contentOther
+)
+
+// rdfMediaTypes are the RDF serialisations recognised as metadata documents.
+var rdfMediaTypes = map[string]bool{
+	"text/turtle":           true,
+	"application/x-turtle":  true,
+	"application/rdf+xml":   true,
+	"application/n-triples": true,
+	"application/n-quads":   true,
+	"text/n3":               true,
+	"application/trig":      true,
+}
+
+// extensionTypes is used to guess the media type of a resource when
+// the server does not give a useful one.
+var extensionTypes = map[string]string{
+	".html":    "text/html",
+	".htm":     "text/html",
+	".xml":     "application/xml",
+	".jsonld":  "application/ld+json",
+	".json-ld": "application/ld+json",
+	".json":    "application/json",
+	".ttl":     "text/turtle",
+	".rdf":     "application/rdf+xml",
+	".owl":     "application/rdf+xml",
+	".nt":      "application/n-triples",
+	".nq":      "application/n-quads",
+	".n3":      "text/n3",
+	".trig":    "application/trig",
+}
+
+// binaryExtensions are never requested, they are downloads and media
+// files that can not contain any markup. Text files, as .txt, .csv or
+// .js, are left to the Content-Type check.
+var binaryExtensions = map[string]bool{
+	".pdf": true, ".doc": true, ".docx": true, ".xls": true, ".xlsx": true,
+	".ppt": true, ".pptx": true, ".odt": true, ".ods": true,
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true,
+	".tar": true, ".rar": true, ".7z": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true,
+	".bmp": true, ".tif": true, ".tiff": true, ".ico": true, ".webp": true,
+	".mp3": true, ".mp4": true, ".avi": true, ".mov": true, ".wav": true,
+	".ogg": true, ".webm": true,
+	".css": true, ".woff": true, ".woff2": true, ".ttf": true, ".eot": true,
+	".exe": true, ".dmg": true, ".iso": true, ".jar": true, ".bin": true,
+	".fasta": true, ".fa": true, ".fna": true, ".faa": true, ".fastq": true, ".fq": true,
+	".bam": true, ".sam": true, ".cram": true, ".vcf": true, ".bed": true,
+	".gff": true, ".gff3": true, ".gtf": true, ".gb": true, ".gbk": true,
+	".embl": true, ".pdb": true, ".cif": true, ".sdf": true, ".mol": true,
+	".h5": true, ".hdf5": true,
+}
+
+// mediaType returns the bare media type of a Content-Type header value,
+// falling back to the one guessed from the URL path extension when the
+// header is missing or generic.
+func mediaType(contentType string, urlPath string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = ""
+	}
+	mt = strings.ToLower(mt)
+
+	switch mt {
+	case "", "application/octet-stream", "text/plain", "binary/octet-stream":
+		if guess, ok := extensionTypes[strings.ToLower(path.Ext(urlPath))]; ok {
+			return guess
+		}
+	}
+	return mt
+}
+
+// classifyMediaType tells which kind of document a media type is.
+func classifyMediaType(mt string) contentKind {
+	switch {
+	case mt == "":
+		return contentUnknown
+	case mt == "text/html" || mt == "application/xhtml+xml":
+		return contentHTML
+	case mt == "application/ld+json":
+		return contentJSONLD
+	case rdfMediaTypes[mt]:
+		return contentRDF
+	case mt == "application/json" || strings.HasSuffix(mt, "+json"):
+		return contentJSON
+	case mt == "application/xml" || mt == "text/xml" || strings.HasSuffix(mt, "+xml"):
+		return contentXML
+	}
+	return contentOther
+}
+
+// isBinaryURL reports whether the URL path points to a file type
+// that is skipped without requesting it.
+func isBinaryURL(urlPath string) bool {
+	return binaryExtensions[strings.ToLower(path.Ext(urlPath))]
+}
+
+// checkHead issues a HEAD request for the given URL and reports whether
+// the resource should be skipped, based on its Content-Type and
+// Content-Length. Servers that do not answer HEAD requests are not skipped.
+func (cw *Crawler) checkHead(r *colly.Request) bool {
+	req, err := http.NewRequest("HEAD", r.URL.String(), nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("User-Agent", cw.C.UserAgent)
+
+	resp, err := cw.httpClient.Do(req)
+	if err != nil {
+		log.Debug("HEAD request failed ", r.URL, " ", err)
+		return false
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return false
+	}
+
+	if classifyMediaType(mediaType(resp.Header.Get("Content-Type"), r.URL.Path)) == contentOther {
+		log.WithFields(log.Fields{
+			"URL":         r.URL,
+			"ContentType": resp.Header.Get("Content-Type"),
+		}).Info("Skipping non markup resource")
+		return true
+	}
+
+	if cw.MaxBodySize > 0 {
+		if l, err := strconv.Atoi(resp.Header.Get("Content-Length")); err == nil && l > cw.MaxBodySize {
+			log.WithFields(log.Fields{
+				"URL":  r.URL,
+				"Size": l,
+			}).Info("Skipping resource larger than max body size")
+			return true
+		}
+	}
+	return false
+}
+
+// handleDocument extracts the metadata of responses that are metadata
+// documents on their own, i.e. JSON-LD, JSON and RDF files.
+// HTML and XML responses are handled by the collector callbacks, HTML
+// pages are only negotiated here for their other representations.
+func (cw *Crawler) handleDocument(r *colly.Response) {
+	if cw.MaxBodySize > 0 && len(r.Body) >= cw.MaxBodySize {
+		log.Warn("Response body truncated at max body size ", r.Request.URL)
+	}
+
+	mt := mediaType(r.Headers.Get("Content-Type"), r.Request.URL.Path)
+
+	switch classifyMediaType(mt) {
+	case contentJSONLD, contentJSON:
+		log.Warn("JSON document found ", r.Request.URL)
+		cw.emitJSONLD(r.Request.URL.String(), "", 0, string(r.Body), classifyMediaType(mt) == contentJSON)
+
+	case contentRDF:
+		log.Warn("RDF document found ", r.Request.URL)
+		triples, err := ParseRDF(mt, r.Body, r.Request.URL.String())
+		if err != nil {
+			log.Error("Error parsing RDF document ", r.Request.URL, " ", err)
+			return
+		}
+		cw.emit(Record{Page: r.Request.URL.String(), Extractor: ExtractorRDF, Metadata: map[string]interface{}{
+			"representation": mt,
+			"triples":        triples,
+		}})
+
+	case contentHTML:
+		if cw.Negotiate {
+			cw.negotiate(r.Request.URL.String())
+		}
+	}
+}
+
+// document is a resource fetched outside of the collector.
+type document struct {
+	URL       string
+	MediaType string
+	Status    int
+	Header    http.Header
+	Body      []byte
+}
+
+// fetchDocument requests a URL with the given Accept header using the
+// crawler HTTP client, the body is read up to MaxBodySize.
+func (cw *Crawler) fetchDocument(u string, accept string) (*document, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", cw.C.UserAgent)
+	req.Header.Set("Accept", accept)
+
+	resp, err := cw.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body io.Reader = resp.Body
+	if cw.MaxBodySize > 0 {
+		body = io.LimitReader(resp.Body, int64(cw.MaxBodySize))
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &document{
+		URL:       resp.Request.URL.String(),
+		MediaType: mediaType(resp.Header.Get("Content-Type"), resp.Request.URL.Path),
+		Status:    resp.StatusCode,
+		Header:    resp.Header,
+		Body:      b,
+	}, nil
+}
+
+// emitJSONLD parses a JSON-LD script block or document and emits it.
+// Blocks that had to be repaired record the repairs applied, the ones
+// that can not be parsed are reported as a diagnostic of the page.
+// Plain JSON documents are only emitted when they use JSON-LD keywords.
+func (cw *Crawler) emitJSONLD(page, source string, block int, text string, plainJSON bool) {
+	res, repairs, err := parseJSONLD(text)
+	if err != nil {
+		if plainJSON {
+			log.Debug("Error decoding JSON document ", page, " ", err)
+			return
+		}
+		log.WithFields(log.Fields{
+			"URL":   page,
+			"Block": block,
+			"Error": err,
+		}).Error("Error parsing JSON-LD")
+
+		cw.emit(Record{Page: page, Source: source, Extractor: ExtractorJSONLD, Block: block, Metadata: map[string]interface{}{
+			"diagnostic": map[string]interface{}{
+				"extractor": "json-ld",
+				"block":     block,
+				"error":     err,
+			},
+		}})
+		return
+	}
+
+	if plainJSON && !isJSONLD(res) {
+		log.Debug("JSON document without linked data keywords ", page)
+		return
+	}
+
+	if len(repairs) > 0 {
+		log.WithFields(log.Fields{
+			"URL":     page,
+			"Block":   block,
+			"Repairs": repairs,
+		}).Warn("JSON-LD repaired")
+	}
+
+	cw.emit(Record{Page: page, Source: source, Extractor: ExtractorJSONLD, Block: block, Repairs: repairs, Metadata: res})
+}
+
+// decodeJSONLD unmarshals a JSON-LD document. Top level arrays are
+// wrapped in a @graph so the result is always an object.
+func decodeJSONLD(b []byte) (map[string]interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	switch d := v.(type) {
+	case map[string]interface{}:
+		return d, nil
+	case []interface{}:
+		return map[string]interface{}{"@graph": d}, nil
+	}
+	return nil, fmt.Errorf("JSON-LD document is not an object or array")
+}
+
+// isJSONLD tells if a decoded JSON document uses any JSON-LD keyword
+// at its top level, plain JSON API responses are ignored.
+func isJSONLD(d map[string]interface{}) bool {
+	for _, k := range []string{"@context", "@type", "@graph", "@id"} {
+		if _, ok := d[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isMetadataLink tells if a link element points to a JSON-LD or RDF
+// representation of the page, i.e. rel="alternate" or rel="meta" links
+// of one of those media types.
+func isMetadataLink(rel, typ string) bool {
+	isAlternate := false
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		if r == "alternate" || r == "meta" {
+			isAlternate = true
+		}
+	}
+	if !isAlternate {
+		return false
+	}
+
+	switch classifyMediaType(mediaType(typ, "")) {
+	case contentJSONLD, contentRDF:
+		return true
+	}
+	return false
+}
+
+// defaultMetadataAccept is sent when following metadata links that do
+// not announce their media type.
+const defaultMetadataAccept = "application/ld+json, text/turtle;q=0.9, application/rdf+xml;q=0.8, application/n-triples;q=0.7, application/json;q=0.5"
+
+// followMetadata fetches a metadata document linked from a page and
+// emits its content attributed to that page. Documents are fetched once
+// per crawl and emitted again for every other page that links to them.
+// Links are not subject to the crawl depth or URL filters.
+func (cw *Crawler) followMetadata(page, href, typ string) {
+	key := page + " " + href
+	if cw.followed[key] {
+		return
+	}
+	cw.followed[key] = true
+
+	d, ok := cw.linked[href]
+	if !ok {
+		d = cw.fetchMetadata(href, typ)
+		cw.linked[href] = d
+	}
+	if d == nil {
+		return
+	}
+
+	switch classifyMediaType(d.MediaType) {
+	case contentJSONLD, contentJSON:
+		log.Warn("Linked JSON document found ", href)
+		cw.emitJSONLD(page, d.URL, 0, string(d.Body), classifyMediaType(d.MediaType) == contentJSON)
+
+	case contentRDF:
+		triples, err := ParseRDF(d.MediaType, d.Body, d.URL)
+		if err != nil {
+			log.Error("Error parsing linked RDF document ", href, " ", err)
+			return
+		}
+		log.Warn("Linked RDF document found ", href)
+		cw.emit(Record{Page: page, Source: d.URL, Extractor: ExtractorRDF, Metadata: map[string]interface{}{
+			"representation": d.MediaType,
+			"triples":        triples,
+		}})
+
+	default:
+		log.Debug("Linked document is not metadata ", href, " ", d.MediaType)
+	}
+}
+
+// fetchMetadata fetches a linked metadata document, it returns nil when
+// it can not be fetched.
+func (cw *Crawler) fetchMetadata(href, typ string) *document {
+	accept := typ
+	if accept == "" {
+		accept = defaultMetadataAccept
+	}
+
+	d, err := cw.fetchDocument(href, accept)
+	if err != nil {
+		log.Error("Error following metadata link ", href, " ", err)
+		return nil
+	}
+	if d.Status >= 400 {
+		log.WithFields(log.Fields{
+			"URL":      href,
+			"RespCode": d.Status,
+		}).Error("Failed metadata link request")
+		return nil
+	}
+	return d
+}
@@ -0,0 +1,84 @@
+package crawler
+
+import "testing"
+
+func TestMediaTypeFromHeader(t *testing.T) {
+	mt := mediaType("application/ld+json; charset=utf-8", "/data")
+	if mt != "application/ld+json" {
+		t.Errorf("Expecting application/ld+json but got %s", mt)
+	}
+}
+
+func TestMediaTypeFromExtension(t *testing.T) {
+	mt := mediaType("application/octet-stream", "/datasets/ds1.jsonld")
+	if mt != "application/ld+json" {
+		t.Errorf("Expecting application/ld+json but got %s", mt)
+	}
+
+	mt = mediaType("", "/datasets/ds1.ttl")
+	if mt != "text/turtle" {
+		t.Errorf("Expecting text/turtle but got %s", mt)
+	}
+}
+
+func TestClassifyMediaType(t *testing.T) {
+	kinds := map[string]contentKind{
+		"text/html":             contentHTML,
+		"application/ld+json":   contentJSONLD,
+		"application/json":      contentJSON,
+		"application/rdf+xml":   contentRDF,
+		"text/turtle":           contentRDF,
+		"application/xml":       contentXML,
+		"application/pdf":       contentOther,
+		"image/png":             contentOther,
+		"chemical/seq-na-fasta": contentOther,
+		"":                      contentUnknown,
+	}
+
+	for mt, kind := range kinds {
+		if classifyMediaType(mt) != kind {
+			t.Errorf("Expecting kind %d for %s but got %d", kind, mt, classifyMediaType(mt))
+		}
+	}
+}
+
+func TestIsBinaryURL(t *testing.T) {
+	if !isBinaryURL("/files/report.PDF") {
+		t.Errorf("Expecting PDF to be binary")
+	}
+	if isBinaryURL("/datasets/ds1.jsonld") {
+		t.Errorf("Expecting JSON-LD not to be binary")
+	}
+	if isBinaryURL("/downloads/README.txt") || isBinaryURL("/export/datasets.csv") {
+		t.Errorf("Expecting text files to be left to the Content-Type check")
+	}
+	if isBinaryURL("/samples") {
+		t.Errorf("Expecting path without extension not to be binary")
+	}
+}
+
+func TestDecodeJSONLDArray(t *testing.T) {
+	d, err := decodeJSONLD([]byte(`[{"@type": "Dataset"}, {"@type": "Person"}]`))
+	if err != nil {
+		t.Errorf("Expected no error but got %s", err)
+	}
+
+	if len(d["@graph"].([]interface{})) != 2 {
+		t.Errorf("Expecting 2 nodes on @graph but got %v", d["@graph"])
+	}
+}
+
+func TestIsMetadataLink(t *testing.T) {
+	if !isMetadataLink("alternate", "application/ld+json") {
+		t.Errorf("Expecting alternate JSON-LD link to be metadata")
+	}
+	if !isMetadataLink("Meta", "application/rdf+xml") {
+		t.Errorf("Expecting meta RDF/XML link to be metadata")
+	}
+	if isMetadataLink("alternate", "application/rss+xml") {
+		t.Errorf("Expecting RSS feed link not to be metadata")
+	}
+	if isMetadataLink("stylesheet", "text/turtle") {
+		t.Errorf("Expecting stylesheet link not to be metadata")
+	}
+}
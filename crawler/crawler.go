@@ -1,55 +1,76 @@
 package crawler
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"net/http"
 	"net/url"
-	"os"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/gocolly/colly"
-	"github.com/olivere/elastic"
 	log "github.com/sirupsen/logrus"
 )
 
-type pageData struct {
-	Page     string                 `json:"page"`
-	Metadata map[string]interface{} `json:"data"`
-}
-
 // Crawler structure calls collys crawler and
+//
 //	its configured to extract microdata and JSON-LD metadata.
 type Crawler struct {
 	Index          string
 	C              *colly.Collector
 	BaseURL        *url.URL
-	UseElastic     bool
 	SkipQueries    bool
 	MaxDepth       int
 	AllowedDomains []string
-	PagesData      []pageData
 	Filter         string
 	QueryWord      string
-	ElasticClient  *elastic.Client
 	OutputFileName string
-	Client         *elastic.Client
-	OutFile        *os.File
+	Sinks          []Sink
+	MaxBodySize    int
+	CheckHead      bool
+	Negotiate      bool
+	NegotiateTypes []string
+	CrawlID        string
+	// IncludeTypes and ExcludeTypes filter the entities emitted by
+	// @type, subclasses included, and Properties projects them on the
+	// given property paths, e.g. name or creator.name.
+	IncludeTypes []string
+	ExcludeTypes []string
+	Properties   []string
+	// Dedupe lists the types whose entities are emitted once, when the
+	// crawl ends, with the pages they were found on.
+	Dedupe []DedupeRule
+
+	httpClient  *http.Client
+	followed    map[string]bool
+	linked      map[string]*document
+	pages       map[string]pageInfo
+	sinksMu     sync.Mutex
+	completed   int32
+	fetchErrors int32
+	deduped     map[string]*dedupeEntry
+	dedupeKeys  []string
 }
 
 // Init setup the initial configuration for the crawler
 // based on the parameter given when the crawler instance is created.
 func (cw *Crawler) Init() {
-	f, err := os.Create(cw.OutputFileName)
-	if err != nil {
-		log.Error("Error opening file ", f)
-	}
-	cw.OutFile = f
-
 	cacheDir := fmt.Sprintf("bioschemas_gocrawlit_cache/%s_cache", cw.BaseURL.Host)
 
+	cw.httpClient = &http.Client{Timeout: 30 * time.Second}
+	cw.followed = make(map[string]bool)
+	cw.linked = make(map[string]*document)
+	cw.pages = make(map[string]pageInfo)
+
+	// Identifies the records of this crawl among the ones of previous crawls
+	if cw.CrawlID == "" {
+		cw.CrawlID = time.Now().UTC().Format("20060102T150405Z")
+	}
+
 	cw.C = colly.NewCollector(
 		// MaxDepth is 1, so only the links on the scraped page
 		// is visited, and no further links are followed
@@ -71,29 +92,28 @@ func (cw *Crawler) Init() {
 		),
 	)
 
+	if cw.MaxBodySize > 0 {
+		cw.C.MaxBodySize = cw.MaxBodySize
+	}
+
 	cw.C.OnError(func(r *colly.Response, err error) {
 		log.WithFields(log.Fields{
 			"URL":      r.Request.URL,
 			"RespCode": r.StatusCode,
 			"Error":    err,
 		}).Error("Failed request")
+
+		// Pages that may answer next time, as opposed to the missing ones
+		if r.StatusCode == 0 || r.StatusCode >= 500 || r.StatusCode == http.StatusTooManyRequests {
+			atomic.AddInt32(&cw.fetchErrors, 1)
+		}
 	})
 
 	cw.C.OnHTML(`script[type="application/ld+json"]`, func(e *colly.HTMLElement) {
 		log.Warn("Script found ", e.Request.URL)
 		log.Debug(e.Text)
 
-		var res map[string]interface{}
-		if err := json.Unmarshal([]byte(e.Text), &res); err != nil {
-			log.Error("Error getting MAP from microdata json result ")
-		}
-		pageData := pageData{e.Request.URL.String(), res}
-
-		if cw.UseElastic {
-			cw.sendToElastic(pageData)
-		}
-
-		cw.sendToJSONfile(pageData)
+		cw.emitJSONLD(e.Request.URL.String(), "", e.Index, e.Text, false)
 	})
 
 	cw.C.OnHTML(`html`, func(e *colly.HTMLElement) {
@@ -112,16 +132,34 @@ func (cw *Crawler) Init() {
 				return
 			}
 
-			pageData := pageData{e.Request.URL.String(), res}
+			cw.emit(Record{Page: e.Request.URL.String(), Extractor: ExtractorMicrodata, Metadata: res})
+		}
 
-			if cw.UseElastic {
-				cw.sendToElastic(pageData)
-			}
+		//time.Sleep(1 * time.Second)
+	})
+
+	cw.C.OnHTML(`html`, func(e *colly.HTMLElement) {
+		if e.DOM.Find(`[vocab],[typeof]`).Length() == 0 {
+			return
+		}
 
-			cw.sendToJSONfile(pageData)
+		log.Warn("Found RDFa ", e.Request.URL)
+		html, err := goquery.OuterHtml(e.DOM)
+		if err != nil {
+			log.Error("Error getting HTML")
+			return
 		}
 
-		//time.Sleep(1 * time.Second)
+		triples, err := extractRDFa(html, e.Request.URL)
+		if err != nil {
+			log.Error("Error calling extractRDFa ", err)
+			return
+		}
+		if len(triples) > 0 {
+			cw.emit(Record{Page: e.Request.URL.String(), Extractor: ExtractorRDFa, Metadata: map[string]interface{}{
+				"triples": triples,
+			}})
+		}
 	})
 
 	cw.C.OnHTML("a[href]", func(e *colly.HTMLElement) {
@@ -164,85 +202,72 @@ func (cw *Crawler) Init() {
 
 	// Before making a request print "Visiting ..."
 	cw.C.OnRequest(func(r *colly.Request) {
-		r.Headers.Add("Accept", "text/html")
+		if isBinaryURL(r.URL.Path) {
+			log.Debug("Skipping binary resource ", r.URL.String())
+			r.Abort()
+			return
+		}
+
+		if cw.CheckHead && cw.checkHead(r) {
+			r.Abort()
+			return
+		}
+
+		r.Headers.Add("Accept", "text/html,application/xhtml+xml,application/ld+json;q=0.9,*/*;q=0.8")
+		r.Ctx.Put(requestedURL, r.URL.String())
 		log.Info("Visiting ", r.URL.String())
 	})
-}
 
-// Start visits the url given as entry point starting
-// starting the crawling process.
-func (cw *Crawler) Start() {
-	defer cw.OutFile.Close()
-	cw.C.Visit(cw.BaseURL.String())
-}
+	cw.C.OnResponse(cw.recordPage)
+	cw.C.OnResponse(cw.handleDocument)
 
-func (cw *Crawler) sendToElastic(p pageData) {
-	ctx := context.Background()
-	data := p.Metadata
-	data["page"] = p.Page
-	_, err := cw.Client.Index().Index(cw.Index).Type("page").BodyJson(data).Do(ctx)
-	if err != nil {
-		log.Panic("Error indexig ", p.Page)
-	}
-}
+	// FAIR Signposting links from headers and the HTML head
+	cw.C.OnResponse(func(r *colly.Response) {
+		for _, h := range (*r.Headers)["Link"] {
+			addSignposting(r.Ctx, parseLinkHeader(h, r.Request.URL))
+		}
+	})
 
-func (cw *Crawler) sendToJSONfile(p pageData) {
-	data := p.Metadata
-	data["page"] = p.Page
+	cw.C.OnHTML(`head link[rel]`, func(e *colly.HTMLElement) {
+		addSignposting(e.Request.Ctx, signpostingLinks(e.Attr("rel"), e.Request.AbsoluteURL(e.Attr("href")), e.Attr("type"), e.Attr("profile"), e.Request.URL))
+	})
 
-	j, err := json.Marshal(data)
-	if err != nil {
-		log.Error("Error at marshalling lemap to json ", err)
-	}
+	// JSON-LD and RDF metadata linked as an alternate representation
+	cw.C.OnHTML(`head link[rel][href][type]`, func(e *colly.HTMLElement) {
+		if isMetadataLink(e.Attr("rel"), e.Attr("type")) {
+			cw.followMetadata(e.Request.URL.String(), e.Request.AbsoluteURL(e.Attr("href")), e.Attr("type"))
+		}
+	})
 
-	_, err = cw.OutFile.WriteString(string(j) + "\n")
-	if err != nil {
-		log.Error("Error writing output file line ", err)
-	}
+	cw.C.OnScraped(cw.emitSignposting)
+	cw.C.OnScraped(cw.pageDone)
+	cw.C.OnScraped(cw.forgetPage)
 }
 
-// ElasticInit sets up the initial configuration for the
-//	crawler's elastic interface
-func (cw *Crawler) ElasticInit() error {
-
-	ctx := context.Background()
-
-	c, err := elastic.NewClient(
-		elastic.SetSniff(false),
-	)
-	if err != nil {
-		log.Panic("Error creating elastic client ", err)
-		return err
-	}
-
-	cw.Client = c
-
-	inf, code, err := cw.Client.Ping("http://127.0.0.1:9200").Do(ctx)
-	if err != nil {
-		log.Panic("Error Pinging elastic client ", err)
-		return err
-	}
-	log.Info(fmt.Sprintf("Elasticsearch returned with code %d and version %s\n", code, inf.Version.Number))
-
-	ex, err := cw.Client.IndexExists(cw.Index).Do(ctx)
-	if err != nil {
-		log.Panic("Error fetchin index existence ", err)
+// Start visits the url given as entry point starting
+// starting the crawling process. It fails without crawling when a
+// sink can not be opened.
+func (cw *Crawler) Start() error {
+	if err := cw.openSinks(); err != nil {
 		return err
 	}
+	defer cw.Close()
+	cw.C.Visit(cw.BaseURL.String())
+	atomic.StoreInt32(&cw.completed, 1)
+	return nil
+}
 
-	if !ex {
-		in, err := cw.Client.CreateIndex(cw.Index).Do(ctx)
-		log.Info("Creating index " + cw.Index)
-		if err != nil {
-			log.Panic("Error creating index  ", err)
-		}
-
-		if !in.Acknowledged {
-			log.Error("Index creation not acknowledged")
-		}
-	}
+// FetchErrors returns the number of pages that could not be fetched
+// because of a network error, a timeout or a server error, which may
+// still have the metadata found by previous crawls.
+func (cw *Crawler) FetchErrors() int {
+	return int(atomic.LoadInt32(&cw.fetchErrors))
+}
 
-	return nil
+// Completed tells whether the crawl went through, as opposed to being
+// interrupted.
+func (cw *Crawler) Completed() bool {
+	return atomic.LoadInt32(&cw.completed) == 1
 }
 
 func extractMicrodata(html string, baseURL *url.URL) (map[string]interface{}, error) {
@@ -268,27 +293,3 @@ func extractMicrodata(html string, baseURL *url.URL) (map[string]interface{}, er
 	return res, nil
 
 }
-
-// ToJSONfile creates a file with the information
-// store on PagesData which contains the microdata and JSON-LD metadata
-// extracted from the pages visited.
-func (cw *Crawler) ToJSONfile() error {
-	nq := cw.BaseURL
-	nq.RawQuery = ""
-	p := strings.Replace(cw.BaseURL.Path, "/", "_", -1)
-	f := fmt.Sprintf("%s%sschema.json", cw.BaseURL.Host, p)
-
-	j, err := json.Marshal(cw.PagesData)
-	if err != nil {
-		log.Error("Error at marshalling pagesData to json ", err)
-		return err
-	}
-
-	log.Info("Creating file ", f)
-	err = ioutil.WriteFile(f, j, 0644)
-	if err != nil {
-		log.Error("Error writing output file ", err)
-		return err
-	}
-	return nil
-}
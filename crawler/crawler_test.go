@@ -0,0 +1,367 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testSite serves the given handlers and counts the requests made to
+// them by method and path, e.g. "GET /".
+type testSite struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func newTestSite(handlers map[string]http.HandlerFunc) *testSite {
+	s := &testSite{requests: make(map[string]int)}
+	mux := http.NewServeMux()
+	for p, h := range handlers {
+		h := h
+		mux.HandleFunc(p, func(w http.ResponseWriter, r *http.Request) {
+			s.mu.Lock()
+			s.requests[r.Method+" "+r.URL.Path]++
+			s.mu.Unlock()
+			h(w, r)
+		})
+	}
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *testSite) count(request string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[request]
+}
+
+// crawl runs a crawler from the given path of the site, the crawler
+// is configured by fn before it is initialised, and returns its records.
+func (s *testSite) crawl(t *testing.T, start string, fn func(cw *Crawler)) []Record {
+	base, err := url.Parse(s.URL + start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw := &Crawler{
+		BaseURL:        base,
+		MaxDepth:       2,
+		AllowedDomains: []string{base.Host},
+		Filter:         ".*",
+	}
+	if fn != nil {
+		fn(cw)
+	}
+	cw.Init()
+	// Responses of previous runs must not be replayed
+	cw.C.CacheDir = ""
+
+	m := &memorySink{}
+	cw.AddSink(m)
+	cw.Start()
+	if !m.closed {
+		t.Errorf("Expecting the sink to be closed once the crawl ends")
+	}
+	return m.records
+}
+
+func serveHTML(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, body)
+	}
+}
+
+func TestCrawlerNegotiate(t *testing.T) {
+	site := newTestSite(map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			switch accept := r.Header.Get("Accept"); {
+			case strings.HasPrefix(accept, "text/turtle"):
+				w.Header().Set("Content-Type", "text/turtle")
+				fmt.Fprint(w, `<http://example.com/ds> <http://schema.org/name> "Genes" .`)
+			case strings.HasPrefix(accept, "application/ld+json"):
+				w.Header().Set("Content-Type", "application/ld+json")
+				fmt.Fprint(w, `{"@context":{"@vocab":"http://schema.org/"},"@id":"http://example.com/ds","@type":"Dataset"}`)
+			default:
+				serveHTML(`<html><head><title>Genes</title></head><body></body></html>`)(w, r)
+			}
+		},
+	})
+	defer site.Close()
+
+	records := site.crawl(t, "/", func(cw *Crawler) {
+		cw.Negotiate = true
+	})
+
+	page := site.URL + "/"
+	found := make(map[string]bool)
+	for _, r := range records {
+		if r.Extractor != ExtractorRDF {
+			continue
+		}
+		if r.Page != page || r.Source != page {
+			t.Errorf("Expecting the representation of %s but got %s from %s", page, r.Page, r.Source)
+		}
+		mt, _ := r.Metadata["representation"].(string)
+		found[mt] = true
+		if triples, _ := r.Metadata["triples"].([]Triple); len(triples) == 0 {
+			t.Errorf("Expecting the triples of the %s representation", mt)
+		}
+	}
+	for _, mt := range []string{"text/turtle", "application/ld+json"} {
+		if !found[mt] {
+			t.Errorf("Expecting the %s representation to be negotiated, got %v", mt, found)
+		}
+	}
+	if len(found) != 2 {
+		t.Errorf("Expecting only the representations offered, got %v", found)
+	}
+}
+
+func TestCrawlerCheckHead(t *testing.T) {
+	site := newTestSite(map[string]http.HandlerFunc{
+		"/": serveHTML(`<html><body>
+			<a href="/large">Large</a>
+			<a href="/report">Report</a>
+			<a href="/dataset">Dataset</a>
+			</body></html>`),
+		"/large": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Length", "4096")
+			if r.Method != "HEAD" {
+				fmt.Fprint(w, strings.Repeat(" ", 4096))
+			}
+		},
+		"/report": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/pdf")
+		},
+		"/dataset": serveHTML(`<html><head>
+			<script type="application/ld+json">{"@context":"http://schema.org","@type":"Dataset","name":"Genes"}</script>
+			</head></html>`),
+	})
+	defer site.Close()
+
+	records := site.crawl(t, "/", func(cw *Crawler) {
+		cw.CheckHead = true
+		cw.MaxBodySize = 1024
+	})
+
+	for _, p := range []string{"/large", "/report"} {
+		if site.count("HEAD "+p) != 1 {
+			t.Errorf("Expecting a HEAD request for %s", p)
+		}
+		if n := site.count("GET " + p); n != 0 {
+			t.Errorf("Expecting %s to be skipped but it was fetched %d times", p, n)
+		}
+	}
+	if site.count("GET /dataset") != 1 {
+		t.Errorf("Expecting /dataset to be fetched once its HEAD request went through")
+	}
+
+	if len(records) != 1 || records[0].Page != site.URL+"/dataset" || records[0].Metadata["name"] != "Genes" {
+		t.Errorf("Expecting the dataset of /dataset but got %v", records)
+	}
+}
+
+func TestCrawlerDescribedBy(t *testing.T) {
+	site := newTestSite(map[string]http.HandlerFunc{
+		"/dataset": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Link", `</meta.jsonld>; rel="describedby"; type="application/ld+json"`)
+			serveHTML(`<html><head><link rel="describedby" href="/meta.jsonld"></head></html>`)(w, r)
+		},
+		"/meta.jsonld": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/ld+json")
+			fmt.Fprint(w, `{"@context":"http://schema.org","@type":"Dataset","name":"Genes"}`)
+		},
+	})
+	defer site.Close()
+
+	// The metadata link is off the crawl path
+	records := site.crawl(t, "/dataset", func(cw *Crawler) {
+		cw.Filter = "/dataset$"
+	})
+
+	if n := site.count("GET /meta.jsonld"); n != 1 {
+		t.Errorf("Expecting the describedby link to be fetched once but it was fetched %d times", n)
+	}
+
+	page := site.URL + "/dataset"
+	var links, entities int
+	for _, r := range records {
+		if r.Page != page {
+			t.Errorf("Expecting the records of %s but got %s", page, r.Page)
+		}
+		switch r.Extractor {
+		case ExtractorSignposting:
+			l, _ := r.Metadata["signposting"].([]SignpostingLink)
+			links = len(l)
+		case ExtractorJSONLD:
+			entities++
+			if r.Source != site.URL+"/meta.jsonld" || r.Metadata["name"] != "Genes" {
+				t.Errorf("Expecting the dataset of the describedby link but got %v from %s", r.Metadata, r.Source)
+			}
+		}
+	}
+	if links != 2 {
+		t.Errorf("Expecting the header and HTML signposting links to be recorded, got %d", links)
+	}
+	if entities != 1 {
+		t.Errorf("Expecting the dataset to be emitted once, got %d", entities)
+	}
+}
+
+func TestCrawlerRedirect(t *testing.T) {
+	site := newTestSite(map[string]http.HandlerFunc{
+		"/old": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		},
+		"/new": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Link", `</meta.jsonld>; rel="describedby"; type="application/ld+json"`)
+			serveHTML(`<html><head>
+				<script type="application/ld+json">{"@context":"http://schema.org","@type":"Dataset","name":"Genes"}</script>
+				</head></html>`)(w, r)
+		},
+		"/meta.jsonld": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/ld+json")
+			fmt.Fprint(w, `{"@context":"http://schema.org","@type":"Organization","name":"EBI"}`)
+		},
+	})
+	defer site.Close()
+
+	records := site.crawl(t, "/old", nil)
+
+	if len(records) != 3 {
+		t.Fatalf("Expecting the script, signposting and describedby records but got %v", records)
+	}
+	for _, r := range records {
+		if r.Page != site.URL+"/old" || r.FinalURL != site.URL+"/new" {
+			t.Errorf("Expecting the %s record to be of %s/old redirected to %s/new but got %s and %s",
+				r.Extractor, site.URL, site.URL, r.Page, r.FinalURL)
+		}
+		if r.Status != http.StatusOK || r.Hash == "" {
+			t.Errorf("Expecting the %s record to have the response status and hash, got %d and %q", r.Extractor, r.Status, r.Hash)
+		}
+	}
+}
+
+func TestCrawlerAlternateLink(t *testing.T) {
+	site := newTestSite(map[string]http.HandlerFunc{
+		"/dataset": serveHTML(`<html><head>
+			<link rel="alternate" type="text/turtle" href="/meta.ttl">
+			<link rel="meta" type="text/turtle" href="/meta.ttl">
+			<link rel="alternate" type="application/atom+xml" href="/feed">
+			</head></html>`),
+		"/meta.ttl": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/turtle")
+			fmt.Fprint(w, `<http://example.com/ds> <http://schema.org/name> "Genes" .`)
+		},
+		"/feed": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/atom+xml")
+		},
+	})
+	defer site.Close()
+
+	// The metadata link is off the crawl path
+	records := site.crawl(t, "/dataset", func(cw *Crawler) {
+		cw.Filter = "/dataset$"
+	})
+
+	if n := site.count("GET /meta.ttl"); n != 1 {
+		t.Errorf("Expecting the alternate link to be fetched once but it was fetched %d times", n)
+	}
+	if site.count("GET /feed") != 0 {
+		t.Errorf("Expecting alternate links of other types not to be followed")
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("Expecting the record of the alternate link but got %v", records)
+	}
+	r := records[0]
+	if r.Page != site.URL+"/dataset" || r.Source != site.URL+"/meta.ttl" || r.Extractor != ExtractorRDF {
+		t.Errorf("Expecting the triples of /meta.ttl credited to /dataset but got %s from %s", r.Page, r.Source)
+	}
+	if triples, _ := r.Metadata["triples"].([]Triple); len(triples) != 1 {
+		t.Errorf("Expecting the triple of /meta.ttl but got %v", r.Metadata["triples"])
+	}
+}
+
+func TestCrawlerSharedDescribedBy(t *testing.T) {
+	page := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `</meta.jsonld>; rel="describedby"; type="application/ld+json"`)
+		serveHTML(`<html><body><a href="/b">b</a></body></html>`)(w, r)
+	}
+	site := newTestSite(map[string]http.HandlerFunc{
+		"/a": page,
+		"/b": page,
+		"/meta.jsonld": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/ld+json")
+			fmt.Fprint(w, `{"@context":"http://schema.org","@type":"Dataset","name":"Genes"}`)
+		},
+	})
+	defer site.Close()
+
+	records := site.crawl(t, "/a", func(cw *Crawler) {
+		cw.Filter = "/[ab]$"
+	})
+
+	if n := site.count("GET /meta.jsonld"); n != 1 {
+		t.Errorf("Expecting the shared describedby link to be fetched once but it was fetched %d times", n)
+	}
+
+	pages := make(map[string]int)
+	for _, r := range records {
+		if r.Extractor == ExtractorJSONLD {
+			pages[r.Page]++
+		}
+	}
+	for _, p := range []string{site.URL + "/a", site.URL + "/b"} {
+		if pages[p] != 1 {
+			t.Errorf("Expecting the dataset to be credited once to %s, got %v", p, pages)
+		}
+	}
+}
+
+func TestCrawlerPageDone(t *testing.T) {
+	site := newTestSite(map[string]http.HandlerFunc{
+		"/a": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Link", `</meta.jsonld>; rel="describedby"; type="application/ld+json"`)
+			serveHTML(`<html><head>
+				<script type="application/ld+json">{"@context":"http://schema.org","@type":"Dataset","name":"A"}</script>
+				</head><body><a href="/b">b</a></body></html>`)(w, r)
+		},
+		"/b": serveHTML(`<html><head>
+			<script type="application/ld+json">{"@context":"http://schema.org","@type":"Dataset","name":"B"}</script>
+			</head></html>`),
+		"/meta.jsonld": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/ld+json")
+			fmt.Fprint(w, `{"@context":"http://schema.org","@type":"Dataset","name":"Meta"}`)
+		},
+	})
+	defer site.Close()
+
+	m := &memorySink{}
+	records := site.crawl(t, "/a", func(cw *Crawler) {
+		cw.Filter = "/[ab]$"
+		cw.AddSink(m)
+	})
+
+	if len(records) != 4 {
+		t.Fatalf("Expecting the records of both pages, the signposting and the describedby ones but got %v", records)
+	}
+	for i, r := range records {
+		done, ok := m.done[r.Page]
+		if !ok {
+			t.Fatalf("Expecting %s to be done, got %v", r.Page, m.done)
+		}
+		if i >= done {
+			t.Errorf("Expecting the %s record of %s before the page is done", r.Extractor, r.Page)
+		}
+	}
+	if m.done[site.URL+"/b"] >= m.done[site.URL+"/a"] {
+		t.Errorf("Expecting the linked page to be done first, got %v", m.done)
+	}
+}
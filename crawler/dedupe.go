@@ -0,0 +1,252 @@
+package crawler
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Keys entities are deduplicated by.
+const (
+	// DedupeAuto uses the @id of the entities, or their content when
+	// they have none.
+	DedupeAuto = "auto"
+	// DedupeID only deduplicates entities with an @id, other than a
+	// blank node one.
+	DedupeID = "id"
+	// DedupeHash uses the content of the entities, @id included.
+	DedupeHash = "hash"
+)
+
+// DedupeRule deduplicates the entities of a type, subclasses included,
+// by the given key. The * type matches every entity.
+type DedupeRule struct {
+	Type string
+	Key  string
+}
+
+// ParseDedupe parses a comma separated list of types to deduplicate,
+// each one optionally followed by its key, e.g. Organization,WebSite:hash.
+func ParseDedupe(s string) ([]DedupeRule, error) {
+	var rules []DedupeRule
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		rule := DedupeRule{Type: spec, Key: DedupeAuto}
+		// The key follows the last colon, unless it is the one of an IRI
+		// or a schema: prefix
+		if i := strings.LastIndex(spec, ":"); i > 0 && !strings.Contains(spec[i:], "/") && spec[:i] != "schema" {
+			rule.Type, rule.Key = spec[:i], spec[i+1:]
+		}
+		if rule.Key != DedupeAuto && rule.Key != DedupeID && rule.Key != DedupeHash {
+			return nil, fmt.Errorf("unknown deduplication key %q of %s, use %s, %s or %s", rule.Key, rule.Type, DedupeAuto, DedupeID, DedupeHash)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// dedupeEntry is a deduplicated entity: the record of the first page it
+// was found on, listing every page.
+type dedupeEntry struct {
+	record Record
+	pages  map[string]bool
+}
+
+// dedupeKey returns the deduplication key of an entity of the given
+// types, or false when it is not deduplicated. Relative @ids are
+// resolved against the base URL of the record, as the same relative
+// @id on different pages names different entities. Blank node @ids
+// are only local to their document, they are taken as no @id.
+func (cw *Crawler) dedupeKey(r Record, types []string, data map[string]interface{}) (string, bool) {
+	key := ""
+	for _, rule := range cw.Dedupe {
+		if rule.Type == "*" {
+			key = rule.Key
+			break
+		}
+		for _, t := range types {
+			if IsSubclass(t, rule.Type) {
+				key = rule.Key
+				break
+			}
+		}
+		if key != "" {
+			break
+		}
+	}
+	if key == "" {
+		return "", false
+	}
+
+	id, _ := data["@id"].(string)
+	blank := strings.HasPrefix(id, "_:")
+	if blank {
+		id = ""
+	}
+	if id != "" && key != DedupeHash {
+		base := r.Source
+		if base == "" {
+			base = r.Page
+		}
+		if b, err := url.Parse(base); err == nil {
+			if u, err := b.Parse(id); err == nil {
+				id = u.String()
+			}
+		}
+		return "id:" + id, true
+	}
+	if key == DedupeID {
+		return "", false
+	}
+
+	// The content is normalised as for Elasticsearch, with short sorted
+	// types, so the same entity has the same hash in JSON-LD and in
+	// microdata. Map keys are marshalled sorted, which makes the JSON
+	// canonical.
+	n := normalizeNode(data)
+	if blank {
+		delete(n, "@id")
+	}
+	if types := shortTypes(data["@type"]); len(types) > 0 {
+		sort.Strings(types)
+		n["@type"] = types
+	}
+	b, err := json.Marshal(n)
+	if err != nil {
+		return "", false
+	}
+	h := sha1.Sum(b)
+	return "hash:" + hex.EncodeToString(h[:]), true
+}
+
+// dedupeEntity keeps a deduplicated entity to emit at the end, as a
+// record with the given metadata. It returns false when the entity is
+// not deduplicated and is to be emitted with its record.
+func (cw *Crawler) dedupeEntity(r Record, types []string, data, md map[string]interface{}) bool {
+	key, ok := cw.dedupeKey(r, types, data)
+	if !ok {
+		return false
+	}
+	if cw.deduped == nil {
+		cw.deduped = make(map[string]*dedupeEntry)
+	}
+
+	e, ok := cw.deduped[key]
+	if !ok {
+		e = &dedupeEntry{record: r, pages: make(map[string]bool)}
+		e.record.Metadata = md
+		e.record.Pages = nil
+		cw.deduped[key] = e
+		cw.dedupeKeys = append(cw.dedupeKeys, key)
+	}
+	if !e.pages[r.Page] {
+		e.pages[r.Page] = true
+		e.record.Pages = append(e.record.Pages, r.Page)
+	}
+	return true
+}
+
+// dedupe takes the deduplicated JSON-LD and microdata entities out of a
+// record. It returns false when none is left and the record is not to be
+// emitted. sinksMu must be held.
+func (cw *Crawler) dedupe(r Record) (Record, bool) {
+	if len(cw.Dedupe) == 0 || r.Metadata["diagnostic"] != nil {
+		return r, true
+	}
+
+	switch r.Extractor {
+	case ExtractorJSONLD:
+		graph, ok := r.Metadata["@graph"].([]interface{})
+		if !ok {
+			data := make(map[string]interface{}, len(r.Metadata))
+			for k, v := range r.Metadata {
+				if k != "@context" {
+					data[k] = v
+				}
+			}
+			return r, !cw.dedupeEntity(r, shortTypes(r.Metadata["@type"]), data, r.Metadata)
+		}
+
+		var kept []interface{}
+		for _, n := range graph {
+			node, ok := n.(map[string]interface{})
+			if !ok {
+				kept = append(kept, n)
+				continue
+			}
+			md := node
+			if ctx, ok := r.Metadata["@context"]; ok {
+				if _, own := node["@context"]; !own {
+					md = copyMap(node)
+					md["@context"] = ctx
+				}
+			}
+			if !cw.dedupeEntity(r, shortTypes(node["@type"]), node, md) {
+				kept = append(kept, n)
+			}
+		}
+		if len(kept) == 0 {
+			return r, false
+		}
+		if len(kept) < len(graph) {
+			r.Metadata = copyMap(r.Metadata)
+			r.Metadata["@graph"] = kept
+		}
+
+	case ExtractorMicrodata:
+		items, _ := r.Metadata["items"].([]interface{})
+		if len(items) == 0 {
+			return r, true
+		}
+		var kept []interface{}
+		for _, i := range items {
+			item, ok := i.(map[string]interface{})
+			if !ok {
+				kept = append(kept, i)
+				continue
+			}
+			md := map[string]interface{}{"items": []interface{}{item}}
+			if !cw.dedupeEntity(r, shortTypes(item["type"]), microdataObject(item), md) {
+				kept = append(kept, i)
+			}
+		}
+		if len(kept) == 0 {
+			return r, false
+		}
+		if len(kept) < len(items) {
+			r.Metadata = copyMap(r.Metadata)
+			r.Metadata["items"] = kept
+		}
+	}
+	return r, true
+}
+
+// emitDeduped sends every deduplicated entity to the sinks, in the order
+// they were first found. sinksMu must be held.
+func (cw *Crawler) emitDeduped() {
+	if len(cw.dedupeKeys) == 0 {
+		return
+	}
+	pages := 0
+	for _, key := range cw.dedupeKeys {
+		e := cw.deduped[key]
+		pages += len(e.record.Pages)
+		cw.write(e.record)
+	}
+	log.WithFields(log.Fields{
+		"Entities":    len(cw.dedupeKeys),
+		"Occurrences": pages,
+	}).Info("Deduplicated entities written")
+
+	cw.deduped = nil
+	cw.dedupeKeys = nil
+}
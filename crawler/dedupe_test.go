@@ -0,0 +1,230 @@
+package crawler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestParseDedupe(t *testing.T) {
+	rules, err := ParseDedupe("Organization, WebSite:hash,schema:Person:id,http://schema.org/Event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []DedupeRule{
+		{"Organization", DedupeAuto},
+		{"WebSite", DedupeHash},
+		{"schema:Person", DedupeID},
+		{"http://schema.org/Event", DedupeAuto},
+	}
+	if len(rules) != len(expected) {
+		t.Fatalf("Expecting %v but got %v", expected, rules)
+	}
+	for i := range expected {
+		if rules[i] != expected[i] {
+			t.Errorf("Expecting %v but got %v", expected[i], rules[i])
+		}
+	}
+
+	if _, err := ParseDedupe("Organization:nope"); err == nil {
+		t.Errorf("Expecting an error for an unknown key")
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	m := &memorySink{}
+	cw := &Crawler{Dedupe: []DedupeRule{{"Organization", DedupeAuto}, {"WebSite", DedupeHash}}}
+	cw.AddSink(m)
+	cw.openSinks()
+
+	page := func(n, name string) map[string]interface{} {
+		var graph map[string]interface{}
+		json.Unmarshal([]byte(`{"@context":"http://schema.org","@graph":[
+			{"@type":"Dataset","name":"`+name+`"},
+			{"@type":"ResearchOrganization","@id":"/#org","name":"EBI `+n+`"},
+			{"@type":"WebSite","name":"Portal"}]}`), &graph)
+		return graph
+	}
+	cw.emit(Record{Page: "http://example.com/1", Extractor: ExtractorJSONLD, Metadata: page("1", "Genes")})
+	cw.emit(Record{Page: "http://example.com/2", Extractor: ExtractorJSONLD, Metadata: page("2", "Proteins")})
+	cw.emit(Record{Page: "http://example.com/2", Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"@type": "WebSite", "name": "Portal"}})
+	cw.emit(Record{Page: "http://example.com/3", Extractor: ExtractorMicrodata, Metadata: map[string]interface{}{"items": []interface{}{
+		map[string]interface{}{"type": []interface{}{"http://schema.org/WebSite"}, "properties": map[string]interface{}{"name": []interface{}{"Portal"}}},
+	}}})
+
+	if len(m.records) != 2 {
+		t.Fatalf("Expecting only the Datasets before the crawl ends but got %v", m.records)
+	}
+	for _, r := range m.records {
+		if g := r.Metadata["@graph"].([]interface{}); len(g) != 1 {
+			t.Errorf("Expecting the boilerplate out of the graph but got %v", g)
+		}
+	}
+
+	cw.Close()
+	if len(m.records) != 4 {
+		t.Fatalf("Expecting the organization and the web site once but got %v", m.records[2:])
+	}
+
+	// the @id is the key of the organization, its content the one of
+	// the web site, which is the same in JSON-LD and microdata
+	org, site := m.records[2], m.records[3]
+	if org.Metadata["name"] != "EBI 1" || org.Metadata["@context"] != "http://schema.org" || org.Page != "http://example.com/1" {
+		t.Errorf("Expecting the organization of the first page but got %v", org)
+	}
+	if len(org.Pages) != 2 || org.Pages[1] != "http://example.com/2" {
+		t.Errorf("Expecting the organization on 2 pages but got %v", org.Pages)
+	}
+	if site.Metadata["name"] != "Portal" || len(site.Pages) != 3 {
+		t.Errorf("Expecting the web site on 3 pages but got %v", site)
+	}
+	if e := org.Envelope(); len(e.Pages) != 2 {
+		t.Errorf("Expecting the pages on the envelope but got %v", e)
+	}
+}
+
+func TestDedupeBlankNodes(t *testing.T) {
+	m := &memorySink{}
+	cw := &Crawler{Dedupe: []DedupeRule{{"Organization", DedupeAuto}, {"Person", DedupeID}}}
+	cw.AddSink(m)
+	cw.openSinks()
+
+	for _, p := range []struct{ page, name string }{{"http://a.com/", "A"}, {"http://b.com/", "B"}, {"http://c.com/", "A"}} {
+		id := "_:b0"
+		if p.page == "http://c.com/" {
+			id = "_:c14n0"
+		}
+		cw.emit(Record{Page: p.page, Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"@type": "Organization", "@id": id, "name": p.name}})
+		cw.emit(Record{Page: p.page, Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"@type": "Person", "@id": id, "name": p.name}})
+	}
+	if len(m.records) != 3 {
+		t.Errorf("Expecting the persons with a blank node @id not to be deduplicated but got %v", m.records)
+	}
+	cw.Close()
+
+	// the organizations are deduplicated by content instead
+	orgs := m.records[3:]
+	if len(orgs) != 2 || orgs[0].Metadata["name"] != "A" || len(orgs[0].Pages) != 2 || orgs[1].Metadata["name"] != "B" {
+		t.Errorf("Expecting the A and B organizations but got %v", orgs)
+	}
+}
+
+func TestDedupeSinkPages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cw := &Crawler{CrawlID: "c1", Dedupe: []DedupeRule{{"Organization", DedupeAuto}}}
+	cw.AddSink(NewAggregateSink(cw, filepath.Join(dir, "out.json"), GroupByType))
+	cw.AddSink(NewParquetSink(filepath.Join(dir, "out.parquet"), ""))
+	db := NewSQLiteSink(filepath.Join(dir, "out.db"))
+	db.crawler = cw
+	cw.AddSink(db)
+	cw.AddSink(NewBleveSink(filepath.Join(dir, "out.bleve")))
+	cw.AddSink(NewTableSink(dir, "out_", FormatCSV))
+	cw.openSinks()
+
+	for _, page := range []string{"http://example.com/1", "http://example.com/2"} {
+		cw.emit(Record{Page: page, Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"@type": "Organization", "@id": "http://example.com/#org", "name": "EBI"}})
+	}
+	cw.Close()
+	expected := "http://example.com/1 http://example.com/2"
+
+	var doc struct {
+		Types map[string][]aggregateEntity `json:"types"`
+	}
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "out.json"))
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if orgs := doc.Types["Organization"]; len(orgs) != 1 || strings.Join(orgs[0].Pages, " ") != expected {
+		t.Errorf("Expecting the organization once with its pages on the JSON document but got %s", b)
+	}
+
+	entities, err := parquet.ReadFile[parquetEntity](filepath.Join(dir, "out.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entities) != 1 || strings.Join(entities[0].Pages, " ") != expected {
+		t.Errorf("Expecting the organization once with its pages on the Parquet file but got %+v", entities)
+	}
+
+	conn, err := sql.Open("sqlite", filepath.Join(dir, "out.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var pages string
+	if err := conn.QueryRow(`SELECT group_concat(url, ' ') FROM (SELECT url FROM entity_pages ORDER BY url)`).Scan(&pages); err != nil || pages != expected {
+		t.Errorf("Expecting the pages of the organization on the database but got %q %v", pages, err)
+	}
+
+	results, _, err := Search(filepath.Join(dir, "out.bleve"), SearchQuery{Types: []string{"Organization"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || strings.Join(results[0].Pages, " ") != expected {
+		t.Errorf("Expecting the organization once with its pages on the search index but got %+v", results)
+	}
+
+	b, _ = ioutil.ReadFile(filepath.Join(dir, "out_Organization.csv"))
+	if string(b) != "page,pages,@id,name\nhttp://example.com/1,http://example.com/1 | http://example.com/2,http://example.com/#org,EBI\n" {
+		t.Errorf("Expecting the organization once with its pages on the table but got %s", b)
+	}
+}
+
+func TestDedupeParquetKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedupe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cw := &Crawler{CrawlID: "c1", Dedupe: []DedupeRule{{"Organization", DedupeAuto}}}
+	cw.AddSink(NewParquetSink(filepath.Join(dir, "out.parquet"), filepath.Join(dir, "props.parquet")))
+	cw.openSinks()
+
+	var md map[string]interface{}
+	json.Unmarshal([]byte(`{"@context":"http://schema.org","@graph":[
+		{"@type":"Organization","@id":"http://example.com/#org","name":"EBI"},
+		{"@type":"Dataset","name":"Genes"}]}`), &md)
+	cw.emit(Record{Page: "http://example.com/1", Extractor: ExtractorJSONLD, Metadata: md})
+	cw.Close()
+
+	entities, err := parquet.ReadFile[parquetEntity](filepath.Join(dir, "out.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entities) != 2 || entities[0].Entity == entities[1].Entity {
+		t.Fatalf("Expecting the dataset and the organization with their own keys but got %+v", entities)
+	}
+	types := make(map[string]string)
+	for _, e := range entities {
+		types[e.Entity] = e.Type
+	}
+
+	props, err := parquet.ReadFile[parquetProperty](filepath.Join(dir, "props.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]string)
+	for _, p := range props {
+		if types[p.Entity] != p.Type {
+			t.Errorf("Expecting the %s property of a %s entity, got %s", p.Path, types[p.Entity], p.Type)
+		}
+		if p.Path == "name" {
+			names[types[p.Entity]] = p.Value
+		}
+	}
+	if names["Dataset"] != "Genes" || names["Organization"] != "EBI" {
+		t.Errorf("Unexpected entity names %v", names)
+	}
+}
@@ -0,0 +1,129 @@
+package crawler
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// resolveIndexName replaces the {host}, {date} and {crawl} placeholders
+// of an index name template. Index names must be lowercase.
+func resolveIndexName(tmpl, host, crawlID string, t time.Time) string {
+	r := strings.NewReplacer(
+		"{host}", strings.Replace(host, ":", "-", -1),
+		"{date}", t.Format("2006.01.02"),
+		"{crawl}", crawlID,
+	)
+	return strings.ToLower(r.Replace(tmpl))
+}
+
+// indexPattern returns the pattern matching every index a template
+// gives for a host, whatever the date or the crawl.
+func indexPattern(tmpl, host string) string {
+	return resolveIndexName(strings.NewReplacer("{date}", "*", "{crawl}", "*").Replace(tmpl), host, "", time.Time{})
+}
+
+// indexMatcher returns the expression matching exactly the indices a
+// template gives for a host. Unlike indexPattern it does not match the
+// indices of the hosts that extend this one, e.g. localhost-8080 for
+// localhost.
+func indexMatcher(tmpl, host string) *regexp.Regexp {
+	name := resolveIndexName(strings.NewReplacer("{date}", "\x00", "{crawl}", "\x01").Replace(tmpl), host, "", time.Time{})
+	expr := strings.NewReplacer(
+		"\x00", `[0-9]{4}\.[0-9]{2}\.[0-9]{2}`,
+		"\x01", `[0-9a-z_.]+`,
+	).Replace(regexp.QuoteMeta(name))
+	return regexp.MustCompile("^" + expr + "$")
+}
+
+// updateAlias points the alias at the index, removing it from the
+// other indices of the site in the same request. The alias may keep
+// pointing at indices of other sites.
+func (s *ElasticSink) updateAlias() error {
+	alias := resolveIndexName(s.Alias, s.host(), s.crawlID(), time.Now().UTC())
+	matcher := indexMatcher(s.Index, s.host())
+
+	actions := []interface{}{
+		map[string]interface{}{"add": map[string]string{"index": s.index, "alias": alias}},
+	}
+
+	status, body, err := s.request("GET", "/_alias/"+alias, nil, "")
+	if err != nil {
+		return err
+	}
+	if status == http.StatusOK {
+		var current map[string]interface{}
+		if err := json.Unmarshal(body, &current); err != nil {
+			return err
+		}
+		for _, index := range sortedKeys(current) {
+			if matcher.MatchString(index) && index != s.index {
+				actions = append(actions, map[string]interface{}{"remove": map[string]string{"index": index, "alias": alias}})
+			}
+		}
+	}
+
+	b, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return err
+	}
+	if err := s.do("POST", "/_aliases", b, nil); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"Alias": alias,
+		"Index": s.index,
+	}).Info("Alias updated")
+	return nil
+}
+
+// applyRetention deletes the oldest indices of the site but the last
+// Keep ones. The current index is never deleted.
+func (s *ElasticSink) applyRetention() error {
+	var indices []struct {
+		Index        string `json:"index"`
+		CreationDate string `json:"creation.date"`
+	}
+	if err := s.do("GET", "/_cat/indices/"+s.pattern()+"?format=json&h=index,creation.date", nil, &indices); err != nil {
+		return err
+	}
+
+	// The pattern also gets the indices of the hosts extending this one
+	matcher := indexMatcher(s.Index, s.host())
+	site := indices[:0]
+	for _, i := range indices {
+		if matcher.MatchString(i.Index) {
+			site = append(site, i)
+		}
+	}
+	indices = site
+
+	sort.Slice(indices, func(i, j int) bool {
+		a, _ := strconv.ParseInt(indices[i].CreationDate, 10, 64)
+		b, _ := strconv.ParseInt(indices[j].CreationDate, 10, 64)
+		if a != b {
+			return a > b
+		}
+		return indices[i].Index > indices[j].Index
+	})
+
+	kept := 0
+	for _, i := range indices {
+		if i.Index == s.index || kept < s.Keep {
+			kept++
+			continue
+		}
+		if err := s.do("DELETE", "/"+i.Index, nil, nil); err != nil {
+			return err
+		}
+		log.Info("Deleted old index ", i.Index)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package crawler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// elasticTextField is a full text field that can also be filtered and
+// aggregated on its exact value.
+var elasticTextField = map[string]interface{}{
+	"type": "text",
+	"fields": map[string]interface{}{
+		"keyword": map[string]interface{}{"type": "keyword", "ignore_above": 256},
+	},
+}
+
+// elasticMapping returns the mapping of the indexed records. The
+// envelope fields are exact values, and in the metadata @id and @type
+// are keywords and every other string full text, which the normalised
+// metadata always is.
+func elasticMapping() map[string]interface{} {
+	keyword := map[string]string{"type": "keyword"}
+	return map[string]interface{}{
+		"dynamic_templates": []interface{}{
+			map[string]interface{}{"ids": map[string]interface{}{"match": "@id", "mapping": keyword}},
+			map[string]interface{}{"types": map[string]interface{}{"match": "@type", "mapping": keyword}},
+			map[string]interface{}{"languages": map[string]interface{}{"match": "@language", "mapping": keyword}},
+			map[string]interface{}{"strings": map[string]interface{}{"match_mapping_type": "string", "mapping": elasticTextField}},
+		},
+		"properties": map[string]interface{}{
+			"version":      map[string]string{"type": "integer"},
+			"page":         keyword,
+			"final_url":    keyword,
+			"status":       map[string]string{"type": "integer"},
+			"fetched_at":   map[string]string{"type": "date"},
+			"content_hash": keyword,
+			"source":       keyword,
+			"extractor":    keyword,
+			"block":        map[string]string{"type": "integer"},
+			"repairs":      keyword,
+			"pages":        keyword,
+			"crawl_id":     keyword,
+			"seed":         keyword,
+			"stale":        map[string]string{"type": "boolean"},
+		},
+	}
+}
+
+// elasticTemplate returns the index template for the given index
+// patterns, as a composable template when supported or as a legacy one.
+// Elasticsearch 6 legacy templates need the mappings of a type.
+func elasticTemplate(patterns []string, composable bool, docType string) map[string]interface{} {
+	var mappings interface{} = elasticMapping()
+	if docType != "" {
+		mappings = map[string]interface{}{docType: mappings}
+	}
+
+	if composable {
+		return map[string]interface{}{
+			"index_patterns": patterns,
+			"priority":       100,
+			"template":       map[string]interface{}{"mappings": mappings},
+		}
+	}
+	return map[string]interface{}{
+		"index_patterns": patterns,
+		"order":          100,
+		"mappings":       mappings,
+	}
+}
+
+// elasticDocument returns the document indexed for a record: its
+// envelope, with the JSON-LD and microdata metadata normalised so a
+// property has the same shape on every page whatever the site
+// publishes, see normalizeNode.
+func elasticDocument(r Record) map[string]interface{} {
+	e := r.Envelope()
+	d := map[string]interface{}{
+		"version":   e.Version,
+		"page":      e.Page,
+		"extractor": e.Extractor,
+		"block":     e.Block,
+		"data":      e.Data,
+	}
+	for k, v := range map[string]string{"final_url": e.FinalURL, "content_hash": e.ContentHash, "source": e.Source} {
+		if v != "" {
+			d[k] = v
+		}
+	}
+	if e.Status != 0 {
+		d["status"] = e.Status
+	}
+	if e.FetchedAt != nil {
+		d["fetched_at"] = e.FetchedAt.Format("2006-01-02T15:04:05.000Z07:00")
+	}
+	if len(e.Repairs) > 0 {
+		d["repairs"] = e.Repairs
+	}
+	if len(e.Pages) > 0 {
+		d["pages"] = e.Pages
+	}
+
+	switch r.Extractor {
+	case ExtractorJSONLD:
+		if _, ok := r.Metadata["diagnostic"]; !ok {
+			d["data"] = normalizeNode(r.Metadata)
+		}
+
+	case ExtractorMicrodata:
+		var graph []interface{}
+		for _, e := range r.Entities() {
+			graph = append(graph, normalizeNode(e.Data))
+		}
+		d["data"] = map[string]interface{}{"@graph": graph}
+	}
+	return d
+}
+
+// normalizeNode normalises a JSON-LD node object: @id is a string,
+// @type an array of strings, name an array of strings and every other
+// property an array of objects with an @id, for references and URLs,
+// an @value, for literals, or the normalised node. Literal values are
+// strings, so a number on a page and a text on another do not clash.
+// The @context and the other keywords are left out.
+func normalizeNode(n map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(n))
+
+	keys := make([]string, 0, len(n))
+	for k := range n {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := n[k]
+		switch k {
+		case "@id":
+			if s, ok := v.(string); ok {
+				res[k] = s
+			}
+		case "@type":
+			var types []string
+			for _, t := range asList(v) {
+				if s, ok := t.(string); ok {
+					types = append(types, s)
+				}
+			}
+			if len(types) > 0 {
+				res[k] = types
+			}
+		case "@graph":
+			var graph []interface{}
+			for _, g := range asList(v) {
+				if m, ok := g.(map[string]interface{}); ok {
+					graph = append(graph, normalizeNode(m))
+				}
+			}
+			res[k] = graph
+		case "name":
+			var names []string
+			for _, nv := range normalizeValues(v) {
+				if s, ok := nv["@value"].(string); ok {
+					names = append(names, s)
+				} else if s, ok := nv["@id"].(string); ok {
+					names = append(names, s)
+				}
+			}
+			if len(names) > 0 {
+				res[k] = names
+			}
+		default:
+			if strings.HasPrefix(k, "@") {
+				continue
+			}
+			if values := normalizeValues(v); len(values) > 0 {
+				res[k] = values
+			}
+		}
+	}
+	return res
+}
+
+// normalizeValues returns a property value as an array of objects.
+func normalizeValues(v interface{}) []map[string]interface{} {
+	var res []map[string]interface{}
+
+	switch val := v.(type) {
+	case nil:
+	case []interface{}:
+		for _, item := range val {
+			res = append(res, normalizeValues(item)...)
+		}
+	case map[string]interface{}:
+		if lit, ok := val["@value"]; ok {
+			if lit == nil {
+				break
+			}
+			o := map[string]interface{}{"@value": fmt.Sprint(lit)}
+			if l, ok := val["@language"].(string); ok {
+				o["@language"] = l
+			}
+			res = append(res, o)
+			break
+		}
+		if l, ok := val["@list"]; ok {
+			return normalizeValues(l)
+		}
+		res = append(res, normalizeNode(val))
+	case string:
+		if isHTTPURL(val) {
+			res = append(res, map[string]interface{}{"@id": val})
+		} else {
+			res = append(res, map[string]interface{}{"@value": val})
+		}
+	default:
+		res = append(res, map[string]interface{}{"@value": fmt.Sprint(val)})
+	}
+	return res
+}
@@ -0,0 +1,223 @@
+package crawler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Entity is a typed thing described in a record, e.g. a Dataset node of
+// a JSON-LD block or a microdata item. Data holds the entity as a
+// JSON-LD like object: @id, @type and its properties.
+type Entity struct {
+	Types []string
+	ID    string
+	Data  map[string]interface{}
+}
+
+// Type returns the first type of the entity, or an empty string.
+func (e Entity) Type() string {
+	if len(e.Types) == 0 {
+		return ""
+	}
+	return e.Types[0]
+}
+
+// Property is a flattened property value of an entity. Path is the
+// dotted property path from the entity, e.g. creator.name.
+type Property struct {
+	Path  string
+	Value string
+}
+
+// Entities returns the top level entities of a record. Schema.org types
+// are shortened to their name, e.g. Dataset.
+func (r Record) Entities() []Entity {
+	if _, ok := r.Metadata["diagnostic"]; ok {
+		return nil
+	}
+
+	var es []Entity
+	switch r.Extractor {
+	case ExtractorJSONLD:
+		nodes := []interface{}{r.Metadata}
+		if g, ok := r.Metadata["@graph"].([]interface{}); ok {
+			nodes = g
+		}
+		for _, n := range nodes {
+			m, ok := n.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			data := make(map[string]interface{}, len(m))
+			for k, v := range m {
+				if k != "@context" {
+					data[k] = v
+				}
+			}
+			id, _ := m["@id"].(string)
+			es = append(es, Entity{Types: shortTypes(m["@type"]), ID: id, Data: data})
+		}
+
+	case ExtractorMicrodata:
+		items, _ := r.Metadata["items"].([]interface{})
+		for _, i := range items {
+			if item, ok := i.(map[string]interface{}); ok {
+				data := microdataObject(item)
+				id, _ := data["@id"].(string)
+				es = append(es, Entity{Types: shortTypes(data["@type"]), ID: id, Data: data})
+			}
+		}
+
+	case ExtractorRDF, ExtractorRDFa:
+		es = tripleEntities(r.Triples())
+	}
+	return es
+}
+
+// microdataObject converts a microdata item to a JSON-LD like object.
+func microdataObject(item map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{})
+	if id, ok := item["id"].(string); ok && id != "" {
+		data["@id"] = id
+	}
+	if types, ok := item["type"].([]interface{}); ok && len(types) > 0 {
+		data["@type"] = types
+	}
+
+	props, _ := item["properties"].(map[string]interface{})
+	for name, v := range props {
+		values, _ := v.([]interface{})
+		var res []interface{}
+		for _, val := range values {
+			if m, ok := val.(map[string]interface{}); ok {
+				res = append(res, microdataObject(m))
+			} else {
+				res = append(res, val)
+			}
+		}
+		if len(res) == 1 {
+			data[name] = res[0]
+		} else {
+			data[name] = res
+		}
+	}
+	return data
+}
+
+// tripleEntities groups triples by subject, every typed subject is an entity.
+func tripleEntities(ts []Triple) []Entity {
+	var subjects []Term
+	props := make(map[Term]map[string]interface{})
+
+	for _, t := range ts {
+		data, ok := props[t.Subject]
+		if !ok {
+			data = make(map[string]interface{})
+			if t.Subject.Type == BlankNode {
+				data["@id"] = "_:" + t.Subject.Value
+			} else {
+				data["@id"] = t.Subject.Value
+			}
+			props[t.Subject] = data
+			subjects = append(subjects, t.Subject)
+		}
+
+		key := shortType(t.Predicate.Value)
+		var value interface{} = t.Object.Value
+		switch {
+		case t.Predicate.Value == rdfType:
+			key = "@type"
+			value = shortType(t.Object.Value)
+		case t.Object.Type == BlankNode:
+			value = map[string]interface{}{"@id": "_:" + t.Object.Value}
+		case t.Object.Type == IRI:
+			value = map[string]interface{}{"@id": t.Object.Value}
+		}
+
+		switch cur := data[key].(type) {
+		case nil:
+			data[key] = value
+		case []interface{}:
+			data[key] = append(cur, value)
+		default:
+			data[key] = []interface{}{cur, value}
+		}
+	}
+
+	var es []Entity
+	for _, s := range subjects {
+		data := props[s]
+		if _, ok := data["@type"]; !ok {
+			continue
+		}
+		id := s.Value
+		if s.Type == BlankNode {
+			id = ""
+		}
+		es = append(es, Entity{Types: shortTypes(data["@type"]), ID: id, Data: data})
+	}
+	return es
+}
+
+// shortTypes returns the short names of a @type value.
+func shortTypes(v interface{}) []string {
+	var types []string
+	for _, t := range asList(v) {
+		if s, ok := t.(string); ok {
+			types = append(types, shortType(s))
+		}
+	}
+	return types
+}
+
+// shortType removes the schema.org vocabulary from a type or property.
+func shortType(t string) string {
+	for _, p := range []string{"http://schema.org/", "https://schema.org/", "schema:"} {
+		if strings.HasPrefix(t, p) {
+			return t[len(p):]
+		}
+	}
+	return t
+}
+
+// Properties flattens the entity data into dotted path and value pairs,
+// arrays give a pair per item and value objects their @value. The
+// entity @type and @context are left out.
+func (e Entity) Properties() []Property {
+	var ps []Property
+	flattenValue("", e.Data, &ps)
+	return ps
+}
+
+func flattenValue(path string, v interface{}, ps *[]Property) {
+	switch val := v.(type) {
+	case nil:
+	case map[string]interface{}:
+		if value, ok := val["@value"]; ok {
+			flattenValue(path, value, ps)
+			return
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			if k == "@context" || (k == "@type" && path == "") {
+				continue
+			}
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			flattenValue(p, val[k], ps)
+		}
+	case []interface{}:
+		for _, item := range val {
+			flattenValue(path, item, ps)
+		}
+	default:
+		*ps = append(*ps, Property{path, fmt.Sprint(val)})
+	}
+}
@@ -0,0 +1,284 @@
+package crawler
+
+import (
+	"strings"
+)
+
+// filtering tells whether the crawler filters entities or projects their
+// properties before emitting the records.
+func (cw *Crawler) filtering() bool {
+	return len(cw.IncludeTypes) > 0 || len(cw.ExcludeTypes) > 0 || len(cw.Properties) > 0
+}
+
+// keepTypes tells whether an entity of the given types passes the type
+// filters. An entity is dropped when any of its types is one of the
+// ExcludeTypes or a subclass of them, otherwise it is kept when
+// IncludeTypes is empty or one of its types is an included one or a
+// subclass of it. Untyped entities only pass when IncludeTypes is empty.
+func (cw *Crawler) keepTypes(types []string) bool {
+	for _, t := range types {
+		for _, x := range cw.ExcludeTypes {
+			if IsSubclass(t, x) {
+				return false
+			}
+		}
+	}
+	if len(cw.IncludeTypes) == 0 {
+		return true
+	}
+	for _, t := range types {
+		for _, i := range cw.IncludeTypes {
+			if IsSubclass(t, i) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filter applies the type filters and the property projection to the
+// entities of a record. It returns false when no entity is left and the
+// record is not to be emitted. Records without entities, like
+// signposting links and diagnostics, are left as they are.
+func (cw *Crawler) filter(r Record) (Record, bool) {
+	if !cw.filtering() || r.Metadata["diagnostic"] != nil {
+		return r, true
+	}
+	props := newPropertyTree(cw.Properties)
+
+	switch r.Extractor {
+	case ExtractorJSONLD:
+		graph, ok := r.Metadata["@graph"].([]interface{})
+		if !ok {
+			if !cw.keepTypes(shortTypes(r.Metadata["@type"])) {
+				return r, false
+			}
+			r.Metadata = props.object(r.Metadata)
+			return r, true
+		}
+
+		var kept []interface{}
+		for _, n := range graph {
+			node, ok := n.(map[string]interface{})
+			if !ok || !cw.keepTypes(shortTypes(node["@type"])) {
+				continue
+			}
+			kept = append(kept, props.object(node))
+		}
+		if len(kept) == 0 {
+			return r, false
+		}
+		r.Metadata = copyMap(r.Metadata)
+		r.Metadata["@graph"] = kept
+
+	case ExtractorMicrodata:
+		items, _ := r.Metadata["items"].([]interface{})
+		var kept []interface{}
+		for _, i := range items {
+			item, ok := i.(map[string]interface{})
+			if !ok || !cw.keepTypes(shortTypes(item["type"])) {
+				continue
+			}
+			kept = append(kept, props.item(item))
+		}
+		if len(kept) == 0 {
+			return r, false
+		}
+		r.Metadata = copyMap(r.Metadata)
+		r.Metadata["items"] = kept
+
+	case ExtractorRDF, ExtractorRDFa:
+		ts, ok := r.Metadata["triples"].([]Triple)
+		if !ok {
+			return r, true
+		}
+		kept := cw.filterTriples(ts, props)
+		if len(kept) == 0 {
+			return r, false
+		}
+		r.Metadata = copyMap(r.Metadata)
+		r.Metadata["triples"] = kept
+	}
+	return r, true
+}
+
+// filterTriples drops the triples of the typed subjects that do not pass
+// the type filters, and the ones of the kept typed subjects whose
+// property is not projected. Only the first step of the property paths
+// applies to triples. The untyped subjects, as the blank nodes of nested
+// entities, follow the triples linking to them: once none is left their
+// triples are dropped too.
+func (cw *Crawler) filterTriples(ts []Triple, props propertyTree) []Triple {
+	types := make(map[Term][]string)
+	linked := make(map[Term]bool)
+	for _, t := range ts {
+		if t.Predicate.Value == rdfType {
+			types[t.Subject] = append(types[t.Subject], shortType(t.Object.Value))
+		} else {
+			linked[t.Object] = true
+		}
+	}
+
+	var kept []Triple
+	for _, t := range ts {
+		st, typed := types[t.Subject]
+		if typed {
+			if !cw.keepTypes(st) {
+				continue
+			}
+			if t.Predicate.Value != rdfType && !props.keeps(shortType(t.Predicate.Value)) {
+				continue
+			}
+		}
+		kept = append(kept, t)
+	}
+
+	// dropping the triples of a subject can leave its own children
+	// unlinked, until no more are
+	for dropped := true; dropped; {
+		dropped = false
+		still := make(map[Term]bool)
+		for _, t := range kept {
+			if t.Predicate.Value != rdfType {
+				still[t.Object] = true
+			}
+		}
+		n := 0
+		for _, t := range kept {
+			if _, typed := types[t.Subject]; !typed && linked[t.Subject] && !still[t.Subject] {
+				dropped = true
+				continue
+			}
+			kept[n] = t
+			n++
+		}
+		kept = kept[:n]
+	}
+	return kept
+}
+
+// propertyTree is the set of property paths to keep, e.g. name and
+// creator.name, as a tree of property names. A nil tree keeps every
+// property, as does a property without children.
+type propertyTree map[string]propertyTree
+
+func newPropertyTree(paths []string) propertyTree {
+	if len(paths) == 0 {
+		return nil
+	}
+	tree := propertyTree{}
+	for _, p := range paths {
+		node := tree
+		for _, name := range strings.Split(strings.TrimSpace(p), ".") {
+			if name == "" {
+				continue
+			}
+			child, ok := node[name]
+			if !ok {
+				child = propertyTree{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return tree
+}
+
+// keeps tells whether a property is projected.
+func (pt propertyTree) keeps(name string) bool {
+	if pt == nil {
+		return true
+	}
+	_, ok := pt[shortType(name)]
+	return ok
+}
+
+// child returns the tree of the nested properties of a property.
+func (pt propertyTree) child(name string) propertyTree {
+	child := pt[shortType(name)]
+	if len(child) == 0 {
+		return nil
+	}
+	return child
+}
+
+// object projects a JSON-LD node. Keywords, as @id, @type and @context,
+// are always kept.
+func (pt propertyTree) object(node map[string]interface{}) map[string]interface{} {
+	if pt == nil {
+		return node
+	}
+	res := make(map[string]interface{}, len(node))
+	for k, v := range node {
+		switch {
+		case strings.HasPrefix(k, "@"):
+			res[k] = v
+		case pt.keeps(k):
+			res[k] = pt.child(k).value(v)
+		}
+	}
+	return res
+}
+
+// value projects the nested nodes of a property value.
+func (pt propertyTree) value(v interface{}) interface{} {
+	if pt == nil {
+		return v
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if _, ok := val["@value"]; ok {
+			return val
+		}
+		return pt.object(val)
+	case []interface{}:
+		res := make([]interface{}, len(val))
+		for i, item := range val {
+			res[i] = pt.value(item)
+		}
+		return res
+	}
+	return v
+}
+
+// item projects a microdata item.
+func (pt propertyTree) item(item map[string]interface{}) map[string]interface{} {
+	props, ok := item["properties"].(map[string]interface{})
+	if pt == nil || !ok {
+		return item
+	}
+	kept := make(map[string]interface{}, len(props))
+	for name, v := range props {
+		if !pt.keeps(name) {
+			continue
+		}
+		child := pt.child(name)
+		values, ok := v.([]interface{})
+		if !ok || child == nil {
+			kept[name] = v
+			continue
+		}
+		res := make([]interface{}, len(values))
+		for i, val := range values {
+			if m, ok := val.(map[string]interface{}); ok {
+				res[i] = child.item(m)
+			} else {
+				res[i] = val
+			}
+		}
+		kept[name] = res
+	}
+
+	res := copyMap(item)
+	res["properties"] = kept
+	return res
+}
+
+// copyMap returns a shallow copy of a map.
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestIsSubclass(t *testing.T) {
+	tests := []struct {
+		t, of string
+		is    bool
+	}{
+		{"Dataset", "Dataset", true},
+		{"Dataset", "CreativeWork", true},
+		{"http://schema.org/DataFeed", "schema:Dataset", true},
+		{"Hospital", "Organization", true},
+		{"Hospital", "Place", true},
+		{"ComputationalWorkflow", "SoftwareSourceCode", true},
+		{"CreativeWork", "Dataset", false},
+		{"Event", "CreativeWork", false},
+		{"Unknown", "Thing", false},
+	}
+	for _, tt := range tests {
+		if IsSubclass(tt.t, tt.of) != tt.is {
+			t.Errorf("Expecting IsSubclass(%s, %s) to be %v", tt.t, tt.of, tt.is)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	m := &memorySink{}
+	cw := &Crawler{
+		IncludeTypes: []string{"CreativeWork"},
+		ExcludeTypes: []string{"WebSite"},
+		Properties:   []string{"name", "creator.name"},
+	}
+	cw.AddSink(m)
+	cw.openSinks()
+
+	var graph map[string]interface{}
+	json.Unmarshal([]byte(`{"@context":"http://schema.org","@graph":[
+		{"@type":"Dataset","@id":"#genes","name":"Genes","description":"All genes","creator":{"@type":"Person","name":"Ana","email":"ana@example.com"}},
+		{"@type":"Organization","name":"EBI"},
+		{"@type":"WebSite","name":"Portal"}]}`), &graph)
+	cw.emit(Record{Page: "http://example.com/1", Extractor: ExtractorJSONLD, Metadata: graph})
+	cw.emit(Record{Page: "http://example.com/1", Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"@type": "Organization", "name": "EBI"}})
+	cw.emit(Record{Page: "http://example.com/1", Extractor: ExtractorMicrodata, Metadata: map[string]interface{}{"items": []interface{}{
+		map[string]interface{}{"type": []interface{}{"http://schema.org/SoftwareApplication"}, "properties": map[string]interface{}{
+			"name": []interface{}{"Tool"}, "url": []interface{}{"http://example.com/tool"},
+		}},
+		map[string]interface{}{"type": []interface{}{"http://schema.org/Event"}, "properties": map[string]interface{}{"name": []interface{}{"Course"}}},
+	}}})
+	cw.emit(Record{Page: "http://example.com/1", Extractor: ExtractorRDFa, Metadata: map[string]interface{}{"triples": []Triple{
+		{NewIRI("http://example.com/ds"), NewIRI(rdfType), NewIRI(schemaOrgVocab + "Dataset")},
+		{NewIRI("http://example.com/ds"), NewIRI(schemaOrgVocab + "name"), NewLiteral("Genes", "", "")},
+		{NewIRI("http://example.com/ds"), NewIRI(schemaOrgVocab + "license"), NewIRI("http://example.com/cc0")},
+		{NewIRI("http://example.com/ds"), NewIRI(schemaOrgVocab + "creator"), NewBlankNode("b0")},
+		{NewBlankNode("b0"), NewIRI(schemaOrgVocab + "name"), NewLiteral("Ana", "", "")},
+		{NewIRI("http://example.com/ds"), NewIRI(schemaOrgVocab + "distribution"), NewBlankNode("b1")},
+		{NewBlankNode("b1"), NewIRI(schemaOrgVocab + "contentUrl"), NewIRI("http://example.com/genes.csv")},
+		{NewBlankNode("b1"), NewIRI(schemaOrgVocab + "encodingFormat"), NewBlankNode("b2")},
+		{NewBlankNode("b2"), NewIRI(schemaOrgVocab + "name"), NewLiteral("CSV", "", "")},
+		{NewIRI("http://example.com/org"), NewIRI(rdfType), NewIRI(schemaOrgVocab + "Organization")},
+		{NewIRI("http://example.com/org"), NewIRI(schemaOrgVocab + "name"), NewLiteral("EBI", "", "")},
+		{NewIRI("http://example.com/org"), NewIRI(schemaOrgVocab + "address"), NewBlankNode("b3")},
+		{NewBlankNode("b3"), NewIRI(schemaOrgVocab + "streetAddress"), NewLiteral("Hinxton", "", "")},
+	}}})
+	cw.emit(Record{Page: "http://example.com/1", Extractor: ExtractorSignposting, Metadata: map[string]interface{}{"links": []interface{}{}}})
+	cw.Close()
+
+	if len(m.records) != 4 {
+		t.Fatalf("Expecting 4 records but got %d: %v", len(m.records), m.records)
+	}
+
+	g := m.records[0].Metadata["@graph"].([]interface{})
+	if len(g) != 1 || m.records[0].Metadata["@context"] != "http://schema.org" {
+		t.Fatalf("Expecting only the Dataset on the graph, got %v", m.records[0].Metadata)
+	}
+	ds := g[0].(map[string]interface{})
+	creator := ds["creator"].(map[string]interface{})
+	if ds["@id"] != "#genes" || ds["name"] != "Genes" || ds["description"] != nil || creator["name"] != "Ana" || creator["email"] != nil || creator["@type"] != "Person" {
+		t.Errorf("Unexpected projected Dataset %v", ds)
+	}
+	// the emitted graph is a copy
+	if len(graph["@graph"].([]interface{})) != 3 {
+		t.Errorf("Expecting the original graph to be left as it was")
+	}
+
+	items := m.records[1].Metadata["items"].([]interface{})
+	props := items[0].(map[string]interface{})["properties"].(map[string]interface{})
+	if len(items) != 1 || props["name"] == nil || props["url"] != nil {
+		t.Errorf("Unexpected microdata items %v", items)
+	}
+
+	// the distribution and the address are left without a link to them
+	ts := m.records[2].Metadata["triples"].([]Triple)
+	if len(ts) != 4 || ts[1].Object.Value != "Genes" || ts[3].Object.Value != "Ana" {
+		t.Errorf("Expecting the Dataset type, name and creator triples but got %v", ts)
+	}
+
+	if m.records[3].Extractor != ExtractorSignposting {
+		t.Errorf("Expecting the signposting record to be kept, got %v", m.records[3])
+	}
+}
@@ -0,0 +1,368 @@
+package crawler
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// jsonLDContext is the subset of a JSON-LD active context the crawler
+// supports: a vocabulary, a base IRI, a default language and term
+// definitions. Remote contexts are not fetched, schema.org ones are
+// known to map every term to the schema.org vocabulary.
+type jsonLDContext struct {
+	vocab    string
+	base     string
+	language string
+	terms    map[string]jsonLDTerm
+}
+
+type jsonLDTerm struct {
+	id       string
+	typ      string
+	language *string
+	list     bool
+}
+
+func (c *jsonLDContext) clone() *jsonLDContext {
+	n := &jsonLDContext{vocab: c.vocab, base: c.base, language: c.language, terms: make(map[string]jsonLDTerm, len(c.terms))}
+	for k, v := range c.terms {
+		n.terms[k] = v
+	}
+	return n
+}
+
+// update returns the context that results of applying a local @context value.
+func (c *jsonLDContext) update(local interface{}) *jsonLDContext {
+	n := c.clone()
+	switch l := local.(type) {
+	case nil:
+		return &jsonLDContext{base: c.base, terms: make(map[string]jsonLDTerm)}
+	case string:
+		if isSchemaOrgContext(l) {
+			n.vocab = schemaOrgVocab
+		} else {
+			log.Debug("Remote JSON-LD context not supported ", l)
+		}
+	case []interface{}:
+		for _, item := range l {
+			n = n.update(item)
+		}
+	case map[string]interface{}:
+		if v, ok := l["@vocab"]; ok {
+			if s, ok := v.(string); ok {
+				n.vocab = n.expandIRI(s, true)
+			} else {
+				n.vocab = ""
+			}
+		}
+		if v, ok := l["@base"].(string); ok {
+			n.base = resolveIRI(n.base, v)
+		}
+		if v, ok := l["@language"]; ok {
+			s, _ := v.(string)
+			n.language = s
+		}
+		for _, k := range sortedKeys(l) {
+			if strings.HasPrefix(k, "@") {
+				continue
+			}
+			switch d := l[k].(type) {
+			case string:
+				n.terms[k] = jsonLDTerm{id: d}
+			case map[string]interface{}:
+				t := jsonLDTerm{}
+				if id, ok := d["@id"].(string); ok {
+					t.id = id
+				}
+				if typ, ok := d["@type"].(string); ok {
+					t.typ = typ
+				}
+				if lang, ok := d["@language"]; ok {
+					s, _ := lang.(string)
+					t.language = &s
+				}
+				if cont, ok := d["@container"].(string); ok && cont == "@list" {
+					t.list = true
+				}
+				n.terms[k] = t
+			case nil:
+				delete(n.terms, k)
+			}
+		}
+		// term IRIs may use prefixes defined in the same context
+		for k, t := range n.terms {
+			if t.id == "" {
+				t.id = k
+			}
+			t.id = n.expandIRI(t.id, true)
+			if t.typ != "" && t.typ != "@id" && t.typ != "@vocab" {
+				t.typ = n.expandIRI(t.typ, true)
+			}
+			n.terms[k] = t
+		}
+	}
+	return n
+}
+
+func isSchemaOrgContext(s string) bool {
+	s = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(s, "https://"), "http://"), "/")
+	return s == "schema.org" || strings.HasPrefix(s, "schema.org/") || strings.HasPrefix(s, "www.schema.org")
+}
+
+// expandIRI expands a term, compact IRI or IRI reference. Vocabulary
+// relative values (properties and types) use @vocab, the others @base.
+// It returns "" when the value can not be turned into an absolute IRI.
+func (c *jsonLDContext) expandIRI(v string, vocab bool) string {
+	if strings.HasPrefix(v, "@") {
+		return v
+	}
+	if t, ok := c.terms[v]; ok && vocab && t.id != "" {
+		return t.id
+	}
+	if i := strings.Index(v, ":"); i > 0 {
+		prefix, suffix := v[:i], v[i+1:]
+		if prefix == "_" {
+			return v
+		}
+		if t, ok := c.terms[prefix]; ok && !strings.HasPrefix(suffix, "//") {
+			return t.id + suffix
+		}
+		return v
+	}
+	if vocab {
+		if c.vocab == "" {
+			return ""
+		}
+		return c.vocab + v
+	}
+	if c.base == "" {
+		return ""
+	}
+	return resolveIRI(c.base, v)
+}
+
+// jsonLDConverter turns expanded-on-the-fly JSON-LD node objects into
+// triples. Keys are visited in order so the output, including blank
+// node labels, only depends on the document.
+type jsonLDConverter struct {
+	bn      *blankNodes
+	triples []Triple
+}
+
+func jsonLDToRDF(doc map[string]interface{}, base string, bn *blankNodes) []Triple {
+	c := &jsonLDConverter{bn: bn}
+	ctx := &jsonLDContext{base: base, terms: make(map[string]jsonLDTerm)}
+	c.node(doc, ctx)
+	return c.triples
+}
+
+func (c *jsonLDConverter) emit(s, p, o Term) {
+	c.triples = append(c.triples, Triple{s, p, o})
+}
+
+func (c *jsonLDConverter) subject(id string) Term {
+	if strings.HasPrefix(id, "_:") {
+		return c.bn.named(id[2:])
+	}
+	return NewIRI(id)
+}
+
+// node converts a node object and returns its subject.
+func (c *jsonLDConverter) node(n map[string]interface{}, ctx *jsonLDContext) Term {
+	if lc, ok := n["@context"]; ok {
+		ctx = ctx.update(lc)
+	}
+
+	for _, g := range asList(n["@graph"]) {
+		if gn, ok := g.(map[string]interface{}); ok {
+			c.node(gn, ctx)
+		}
+	}
+
+	var s Term
+	if id, ok := n["@id"].(string); ok && ctx.expandIRI(id, false) != "" {
+		s = c.subject(ctx.expandIRI(id, false))
+	} else if isGraphContainer(n) {
+		return Term{}
+	} else {
+		s = c.bn.fresh()
+	}
+
+	for _, t := range asList(n["@type"]) {
+		if ts, ok := t.(string); ok {
+			if iri := ctx.expandIRI(ts, true); iri != "" {
+				c.emit(s, NewIRI(rdfType), c.subject(iri))
+			}
+		}
+	}
+
+	for _, k := range sortedKeys(n) {
+		if strings.HasPrefix(k, "@") {
+			continue
+		}
+
+		p := ctx.expandIRI(k, true)
+		if p == "" || strings.HasPrefix(p, "_:") {
+			continue
+		}
+		term := ctx.terms[k]
+
+		if term.list {
+			c.emit(s, NewIRI(p), c.list(asList(n[k]), ctx, term))
+			continue
+		}
+		for _, v := range asList(n[k]) {
+			if o, ok := c.value(v, ctx, term); ok {
+				c.emit(s, NewIRI(p), o)
+			}
+		}
+	}
+	return s
+}
+
+// isGraphContainer tells if an object only wraps a @graph.
+func isGraphContainer(n map[string]interface{}) bool {
+	if _, ok := n["@graph"]; !ok {
+		return false
+	}
+	for k := range n {
+		if k != "@graph" && k != "@context" {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *jsonLDConverter) list(items []interface{}, ctx *jsonLDContext, term jsonLDTerm) Term {
+	var terms []Term
+	for _, v := range items {
+		if o, ok := c.value(v, ctx, term); ok {
+			terms = append(terms, o)
+		}
+	}
+	return emitList(terms, c.bn, c.emit)
+}
+
+// value converts a property value to an RDF term.
+func (c *jsonLDConverter) value(v interface{}, ctx *jsonLDContext, term jsonLDTerm) (Term, bool) {
+	switch val := v.(type) {
+	case nil:
+		return Term{}, false
+	case string:
+		switch term.typ {
+		case "@id":
+			if iri := ctx.expandIRI(val, false); iri != "" {
+				return c.subject(iri), true
+			}
+			return Term{}, false
+		case "@vocab":
+			if iri := ctx.expandIRI(val, true); iri != "" {
+				return c.subject(iri), true
+			}
+			return Term{}, false
+		case "":
+			lang := ctx.language
+			if term.language != nil {
+				lang = *term.language
+			}
+			return NewLiteral(val, "", lang), true
+		}
+		return NewLiteral(val, term.typ, ""), true
+	case bool:
+		return NewLiteral(strconv.FormatBool(val), xsdBoolean, ""), true
+	case float64:
+		return numberLiteral(val, term.typ), true
+	case []interface{}:
+		// nested arrays are taken as lists
+		return c.list(val, ctx, term), true
+	case map[string]interface{}:
+		if lv, ok := val["@value"]; ok {
+			return c.valueObject(val, lv, ctx)
+		}
+		if items, ok := val["@list"]; ok {
+			return c.list(asList(items), ctx, term), true
+		}
+		if items, ok := val["@set"]; ok {
+			l := asList(items)
+			if len(l) == 0 {
+				return Term{}, false
+			}
+			return c.value(l[0], ctx, term)
+		}
+		return c.node(val, ctx), true
+	}
+	return Term{}, false
+}
+
+func (c *jsonLDConverter) valueObject(obj map[string]interface{}, v interface{}, ctx *jsonLDContext) (Term, bool) {
+	datatype := ""
+	if t, ok := obj["@type"].(string); ok {
+		datatype = ctx.expandIRI(t, true)
+	}
+	switch lv := v.(type) {
+	case string:
+		if lang, ok := obj["@language"].(string); ok {
+			return NewLiteral(lv, "", lang), true
+		}
+		return NewLiteral(lv, datatype, ""), true
+	case bool:
+		if datatype == "" {
+			datatype = xsdBoolean
+		}
+		return NewLiteral(strconv.FormatBool(lv), datatype, ""), true
+	case float64:
+		return numberLiteral(lv, datatype), true
+	}
+	return Term{}, false
+}
+
+// numberLiteral converts a JSON number following the JSON-LD rules,
+// integral values are xsd:integer and the others xsd:double.
+func numberLiteral(f float64, datatype string) Term {
+	if f == float64(int64(f)) && datatype != xsdDouble && (f < 1e21 && f > -1e21) {
+		if datatype == "" {
+			datatype = xsdInteger
+		}
+		return NewLiteral(strconv.FormatInt(int64(f), 10), datatype, "")
+	}
+	if datatype == "" {
+		datatype = xsdDouble
+	}
+	s := strconv.FormatFloat(f, 'E', -1, 64)
+	if mant, exp := split(s, "E"); !strings.Contains(mant, ".") {
+		s = mant + ".0E" + strings.TrimPrefix(exp, "+")
+	} else {
+		s = mant + "E" + strings.TrimPrefix(exp, "+")
+	}
+	return NewLiteral(s, datatype, "")
+}
+
+func split(s, sep string) (string, string) {
+	i := strings.Index(s, sep)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i+len(sep):]
+}
+
+func asList(v interface{}) []interface{} {
+	switch l := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return l
+	}
+	return []interface{}{v}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
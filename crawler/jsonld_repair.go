@@ -0,0 +1,202 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Repairs applied by repairJSON.
+const (
+	RepairHTMLComment   = "html-comment"
+	RepairCDATA         = "cdata"
+	RepairTrailingComma = "trailing-comma"
+	RepairControlChar   = "control-character"
+)
+
+var (
+	commentOpen = regexp.MustCompile(`^\s*<!--`)
+	commentEnd  = regexp.MustCompile(`-->\s*$`)
+	cdataOpen   = regexp.MustCompile(`^\s*(//|/\*)?\s*<!\[CDATA\[\s*(\*/)?`)
+	cdataEnd    = regexp.MustCompile(`(//|/\*)?\s*\]\]>\s*(\*/)?\s*$`)
+)
+
+// JSONLDSyntaxError describes where a JSON-LD block could not be parsed,
+// positions refer to the text as found on the page.
+type JSONLDSyntaxError struct {
+	Message string `json:"message"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Offset  int    `json:"offset"`
+	Excerpt string `json:"excerpt"`
+}
+
+func (e *JSONLDSyntaxError) Error() string {
+	return fmt.Sprintf("%s at line %d column %d: %s", e.Message, e.Line, e.Column, e.Excerpt)
+}
+
+// parseJSONLD decodes a JSON-LD block. When it is not valid JSON the
+// common authoring mistakes are repaired and the names of the repairs
+// applied are returned. If the block still can not be decoded the
+// error is a *JSONLDSyntaxError.
+func parseJSONLD(text string) (map[string]interface{}, []string, error) {
+	res, err := decodeJSONLD([]byte(text))
+	if err == nil {
+		return res, nil, nil
+	}
+
+	repaired, offsets, repairs := repairJSON(text)
+	res, err = decodeJSONLD([]byte(repaired))
+	if err == nil {
+		return res, repairs, nil
+	}
+
+	off := len(text)
+	msg := err.Error()
+	if se, ok := err.(*json.SyntaxError); ok {
+		// the offset points right after the offending byte
+		o := int(se.Offset) - 1
+		if o < 0 {
+			o = 0
+		}
+		if o < len(offsets) {
+			off = offsets[o]
+		}
+	}
+	return nil, repairs, newJSONLDSyntaxError(text, off, msg)
+}
+
+func newJSONLDSyntaxError(text string, off int, msg string) *JSONLDSyntaxError {
+	if off > len(text) {
+		off = len(text)
+	}
+	line := strings.Count(text[:off], "\n") + 1
+	lineStart := strings.LastIndex(text[:off], "\n") + 1
+	col := utf8.RuneCountInString(text[lineStart:off]) + 1
+
+	lineEnd := strings.Index(text[off:], "\n")
+	if lineEnd < 0 {
+		lineEnd = len(text)
+	} else {
+		lineEnd += off
+	}
+
+	from, to := off-40, off+40
+	if from < lineStart {
+		from = lineStart
+	}
+	if to > lineEnd {
+		to = lineEnd
+	}
+	excerpt := strings.TrimSpace(strings.ToValidUTF8(text[from:to], ""))
+
+	return &JSONLDSyntaxError{
+		Message: msg,
+		Line:    line,
+		Column:  col,
+		Offset:  off,
+		Excerpt: excerpt,
+	}
+}
+
+// repairJSON fixes HTML comment and CDATA wrappers, trailing commas
+// and raw control characters inside strings. It returns the repaired
+// text, the offset in the original text of every byte of the repaired
+// one and the repairs applied.
+func repairJSON(text string) (string, []int, []string) {
+	var repairs []string
+	applied := make(map[string]bool)
+	repair := func(name string) {
+		if !applied[name] {
+			applied[name] = true
+			repairs = append(repairs, name)
+		}
+	}
+
+	start, end := 0, len(text)
+	for changed := true; changed; {
+		changed = false
+		if loc := commentOpen.FindStringIndex(text[start:end]); loc != nil {
+			start += loc[1]
+			repair(RepairHTMLComment)
+			changed = true
+		}
+		if loc := commentEnd.FindStringIndex(text[start:end]); loc != nil {
+			end = start + loc[0]
+			repair(RepairHTMLComment)
+			changed = true
+		}
+		if loc := cdataOpen.FindStringIndex(text[start:end]); loc != nil {
+			start += loc[1]
+			repair(RepairCDATA)
+			changed = true
+		}
+		if loc := cdataEnd.FindStringIndex(text[start:end]); loc != nil {
+			end = start + loc[0]
+			repair(RepairCDATA)
+			changed = true
+		}
+	}
+
+	var out strings.Builder
+	var offsets []int
+	write := func(s string, orig int) {
+		out.WriteString(s)
+		for j := 0; j < len(s); j++ {
+			offsets = append(offsets, orig)
+		}
+	}
+
+	inString := false
+	for i := start; i < end; i++ {
+		c := text[i]
+
+		if inString {
+			switch {
+			case c == '\\' && i+1 < end:
+				write(text[i:i+2], i)
+				i++
+			case c == '"':
+				inString = false
+				write(`"`, i)
+			case c < 0x20:
+				write(escapeControl(c), i)
+				repair(RepairControlChar)
+			default:
+				write(text[i:i+1], i)
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case ',':
+			j := i + 1
+			for j < end && strings.IndexByte(" \t\r\n", text[j]) >= 0 {
+				j++
+			}
+			if j < end && (text[j] == '}' || text[j] == ']') {
+				repair(RepairTrailingComma)
+				continue
+			}
+		}
+		write(text[i:i+1], i)
+	}
+
+	return out.String(), offsets, repairs
+}
+
+func escapeControl(c byte) string {
+	switch c {
+	case '\n':
+		return `\n`
+	case '\r':
+		return `\r`
+	case '\t':
+		return `\t`
+	}
+	return fmt.Sprintf(`\u%04x`, c)
+}
@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"testing"
+)
+
+func TestParseJSONLDValid(t *testing.T) {
+	res, repairs, err := parseJSONLD(`{"@type": "Dataset", "name": "a, b"}`)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if len(repairs) != 0 {
+		t.Errorf("Expecting no repairs but got %v", repairs)
+	}
+	if res["name"] != "a, b" {
+		t.Errorf("Property value not found")
+	}
+}
+
+func TestParseJSONLDRepairs(t *testing.T) {
+	text := `
+	//<![CDATA[
+	<!--
+	{
+		"@type": "Dataset",
+		"name": "Proteins,]",
+		"description": "Line one
+line two",
+		"keywords": ["a", "b", ],
+	}
+	-->
+	//]]>
+	`
+
+	res, repairs, err := parseJSONLD(text)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	expected := []string{RepairCDATA, RepairHTMLComment, RepairControlChar, RepairTrailingComma}
+	if len(repairs) != len(expected) {
+		t.Fatalf("Expecting repairs %v but got %v", expected, repairs)
+	}
+	for i := range expected {
+		if repairs[i] != expected[i] {
+			t.Errorf("Expecting repairs %v but got %v", expected, repairs)
+		}
+	}
+
+	if res["name"] != "Proteins,]" {
+		t.Errorf("Expecting string content untouched but got %v", res["name"])
+	}
+	if res["description"] != "Line one\nline two" {
+		t.Errorf("Expecting escaped line break but got %q", res["description"])
+	}
+	if len(res["keywords"].([]interface{})) != 2 {
+		t.Errorf("Expecting 2 keywords but got %v", res["keywords"])
+	}
+}
+
+func TestParseJSONLDSyntaxError(t *testing.T) {
+	text := "{\n  \"@type\": \"Dataset\",\n  \"name\": \"Proteínas\" \"url\": \"x\"\n}"
+
+	_, _, err := parseJSONLD(text)
+	if err == nil {
+		t.Fatalf("Expected a syntax error")
+	}
+
+	se, ok := err.(*JSONLDSyntaxError)
+	if !ok {
+		t.Fatalf("Expecting *JSONLDSyntaxError but got %T", err)
+	}
+	if se.Line != 3 || se.Column != 23 {
+		t.Errorf("Expecting error at line 3 column 23 but got line %d column %d", se.Line, se.Column)
+	}
+	if se.Excerpt != `"name": "Proteínas" "url": "x"` {
+		t.Errorf("Unexpected excerpt %q", se.Excerpt)
+	}
+}
+
+func TestParseJSONLDSyntaxErrorAfterRepair(t *testing.T) {
+	text := "<!-- {\"a\": 1,\n\"b\": } -->"
+
+	_, repairs, err := parseJSONLD(text)
+	se, ok := err.(*JSONLDSyntaxError)
+	if !ok {
+		t.Fatalf("Expecting *JSONLDSyntaxError but got %v", err)
+	}
+	if len(repairs) == 0 {
+		t.Errorf("Expecting the comment repair to be reported")
+	}
+	if se.Line != 2 || se.Column != 6 {
+		t.Errorf("Expecting error at line 2 column 6 but got line %d column %d", se.Line, se.Column)
+	}
+}
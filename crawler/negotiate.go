@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultNegotiateTypes are the representations requested through
+// content negotiation when Crawler.NegotiateTypes is empty.
+var DefaultNegotiateTypes = []string{
+	"application/ld+json",
+	"text/turtle",
+	"application/rdf+xml",
+	"application/n-triples",
+}
+
+// negotiate requests the machine readable representations of a page
+// and emits their triples, recording which representation they came from.
+// Representations a server does not offer, i.e. it answers with HTML
+// or with one already seen for the page, are ignored.
+func (cw *Crawler) negotiate(page string) {
+	types := cw.NegotiateTypes
+	if len(types) == 0 {
+		types = DefaultNegotiateTypes
+	}
+
+	seen := make(map[string]bool)
+	for _, accept := range types {
+		d, err := cw.fetchDocument(page, accept)
+		if err != nil {
+			log.Error("Error negotiating ", accept, " for ", page, " ", err)
+			continue
+		}
+		if d.Status >= 400 || seen[d.MediaType] {
+			continue
+		}
+
+		switch classifyMediaType(d.MediaType) {
+		case contentRDF, contentJSONLD, contentJSON:
+		default:
+			continue
+		}
+		seen[d.MediaType] = true
+
+		triples, err := ParseRDF(d.MediaType, d.Body, d.URL)
+		if err != nil {
+			log.Error("Error parsing ", d.MediaType, " representation of ", page, " ", err)
+			continue
+		}
+		if len(triples) == 0 {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"URL":            page,
+			"Representation": d.MediaType,
+			"Triples":        len(triples),
+		}).Warn("Negotiated representation found")
+
+		cw.emit(Record{Page: page, Source: d.URL, Extractor: ExtractorRDF, Metadata: map[string]interface{}{
+			"representation": d.MediaType,
+			"triples":        triples,
+		}})
+	}
+}
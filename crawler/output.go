@@ -0,0 +1,379 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultOutputTemplate is the name of the output file of a crawl.
+const DefaultOutputTemplate = "{host}{path}_schema.jsonl"
+
+// What to do when an output file already exists.
+const (
+	ExistsTimestamp = "timestamp"
+	ExistsRefuse    = "refuse"
+	ExistsOverwrite = "overwrite"
+)
+
+// Output compressions.
+const (
+	CompressNone = "none"
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+var compressExt = map[string]string{
+	CompressGzip: ".gz",
+	CompressZstd: ".zst",
+}
+
+// OutputName replaces the placeholders of an output file name template:
+// {host}, {path} the start URL path with slashes as underscores, {date}
+// and {time}. Slashes of the template give directories.
+func OutputName(tmpl string, u *url.URL, t time.Time) string {
+	p := strings.TrimSuffix(strings.Replace(u.Path, "/", "_", -1), "_")
+	r := strings.NewReplacer(
+		"{host}", strings.Replace(u.Host, ":", "-", -1),
+		"{path}", p,
+		"{date}", t.Format("2006-01-02"),
+		"{time}", t.Format("150405"),
+	)
+	return r.Replace(tmpl)
+}
+
+// splitOutputName splits a file name in its base and its extension,
+// compression included, e.g. out and .jsonl.gz.
+func splitOutputName(name string) (string, string) {
+	ext := filepath.Ext(name)
+	for _, ce := range compressExt {
+		if ext == ce {
+			base := strings.TrimSuffix(name, ext)
+			return strings.TrimSuffix(base, filepath.Ext(base)), filepath.Ext(base) + ext
+		}
+	}
+	return strings.TrimSuffix(name, ext), ext
+}
+
+// outputBase returns the output file name of the crawler without its
+// extension, the other sinks name their files after it.
+func (cw *Crawler) outputBase() string {
+	base, _ := splitOutputName(cw.OutputFileName)
+	return base
+}
+
+// Stdout is the output file name of the standard output.
+const Stdout = "-"
+
+// OutputFile is a file written by a sink, or the standard output when
+// its name is Stdout. It is compressed with gzip
+// or zstd when Compress is set, or when the name ends in .gz or .zst.
+// When the file, or a rotated part of it, exists it is written next to
+// it with a timestamp on its name, it is overwritten, or it is an
+// error, as set by Exists. Overwriting it removes the numbered parts of
+// the earlier output too.
+//
+// A file written with WriteRecord is rotated once it has MaxRecords
+// records or MaxBytes bytes, before compression: the records go on in
+// out.1.jsonl, out.2.jsonl and so on. The standard output is never
+// rotated, and is flushed after every record.
+type OutputFile struct {
+	Name       string
+	Exists     string
+	Compress   string
+	MaxBytes   int64
+	MaxRecords int
+
+	base, ext string
+	part      int
+	f         *os.File
+	z         io.WriteCloser
+	w         *bufio.Writer
+	bytes     int64
+	records   int
+	closed    bool
+}
+
+// NewOutputFile creates an output file that is timestamped when it
+// already exists.
+func NewOutputFile(name string) *OutputFile {
+	return &OutputFile{Name: name, Exists: ExistsTimestamp}
+}
+
+// Open creates the file and its directory.
+func (o *OutputFile) Open() error {
+	if o.Name == Stdout {
+		return o.wrap(os.Stdout)
+	}
+
+	switch o.Compress {
+	case "":
+		_, ext := splitOutputName(o.Name)
+		for c, ce := range compressExt {
+			if strings.HasSuffix(ext, ce) {
+				o.Compress = c
+			}
+		}
+	case CompressNone:
+	case CompressGzip, CompressZstd:
+		if !strings.HasSuffix(o.Name, compressExt[o.Compress]) {
+			o.Name += compressExt[o.Compress]
+		}
+	default:
+		return fmt.Errorf("unknown compression %q, use %s or %s", o.Compress, CompressGzip, CompressZstd)
+	}
+
+	if o.exists() {
+		switch o.Exists {
+		case ExistsOverwrite:
+			log.Warn("Overwriting ", o.Name)
+			// the parts of an earlier, longer output would be read
+			// along with the ones written now
+			for _, p := range o.parts() {
+				log.Warn("Removing the earlier part ", p)
+				if err := os.Remove(p); err != nil {
+					return err
+				}
+			}
+		case ExistsRefuse:
+			return fmt.Errorf("%s or a part of it already exists", o.Name)
+		default:
+			base, ext := splitOutputName(o.Name)
+			name := base + "." + time.Now().UTC().Format("20060102T150405Z") + ext
+			log.Warn(o.Name, " already exists, writing to ", name)
+			o.Name = name
+		}
+	}
+
+	o.base, o.ext = splitOutputName(o.Name)
+	if err := os.MkdirAll(filepath.Dir(o.Name), 0755); err != nil {
+		return err
+	}
+	return o.create(o.Name)
+}
+
+// exists tells whether the output file exists, or any of its rotated
+// parts when it is rotated, so a part left over by an earlier crawl
+// is not found only once the output is rotated.
+func (o *OutputFile) exists() bool {
+	if _, err := os.Stat(o.Name); err == nil {
+		return true
+	}
+	if o.MaxRecords <= 0 && o.MaxBytes <= 0 {
+		return false
+	}
+	return len(o.parts()) > 0
+}
+
+// parts returns the numbered parts of the output file found on disk,
+// e.g. out.1.jsonl and out.2.jsonl for out.jsonl.
+func (o *OutputFile) parts() []string {
+	base, ext := splitOutputName(o.Name)
+	files, err := ioutil.ReadDir(filepath.Dir(o.Name))
+	if err != nil {
+		return nil
+	}
+	var parts []string
+	prefix := filepath.Base(base) + "."
+	for _, f := range files {
+		n := f.Name()
+		if !strings.HasPrefix(n, prefix) || !strings.HasSuffix(n, ext) || len(n) <= len(prefix)+len(ext) {
+			continue
+		}
+		if _, err := strconv.Atoi(n[len(prefix) : len(n)-len(ext)]); err == nil {
+			parts = append(parts, filepath.Join(filepath.Dir(o.Name), n))
+		}
+	}
+	return parts
+}
+
+// create starts writing a part of the output.
+func (o *OutputFile) create(name string) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if o.Exists != ExistsOverwrite {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(name, flags, 0644)
+	if err != nil {
+		return err
+	}
+	if err := o.wrap(f); err != nil {
+		f.Close()
+		return err
+	}
+	return nil
+}
+
+// wrap starts writing to f, through the compressor if any.
+func (o *OutputFile) wrap(f *os.File) error {
+	var w io.Writer = f
+	switch o.Compress {
+	case "", CompressNone:
+		o.z = nil
+	case CompressGzip:
+		o.z = gzip.NewWriter(f)
+		w = o.z
+	case CompressZstd:
+		z, err := zstd.NewWriter(f)
+		if err != nil {
+			return err
+		}
+		o.z = z
+		w = z
+	default:
+		return fmt.Errorf("unknown compression %q, use %s or %s", o.Compress, CompressGzip, CompressZstd)
+	}
+
+	o.f = f
+	o.w = bufio.NewWriter(w)
+	o.bytes, o.records = 0, 0
+	o.closed = false
+	return nil
+}
+
+// Write writes to the current part of the output.
+func (o *OutputFile) Write(p []byte) (int, error) {
+	n, err := o.w.Write(p)
+	o.bytes += int64(n)
+	return n, err
+}
+
+// WriteRecord writes a record, starting a new part of the output first
+// when the current one is full.
+func (o *OutputFile) WriteRecord(p []byte) error {
+	if o.Name == Stdout {
+		if _, err := o.Write(p); err != nil {
+			return err
+		}
+		return o.Flush()
+	}
+
+	full := (o.MaxRecords > 0 && o.records >= o.MaxRecords) || (o.MaxBytes > 0 && o.bytes >= o.MaxBytes)
+	if full && o.records > 0 {
+		if err := o.closePart(); err != nil {
+			return err
+		}
+		o.part++
+		name := o.base + "." + strconv.Itoa(o.part) + o.ext
+		log.Info("Rotating output to ", name)
+		if err := o.create(name); err != nil {
+			return err
+		}
+	}
+
+	if _, err := o.Write(p); err != nil {
+		return err
+	}
+	o.records++
+	return nil
+}
+
+// Flush writes the buffered data to the file.
+func (o *OutputFile) Flush() error {
+	if err := o.w.Flush(); err != nil {
+		return err
+	}
+	if f, ok := o.z.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close flushes and closes the file. Closing it again does nothing.
+func (o *OutputFile) Close() error {
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+	return o.closePart()
+}
+
+func (o *OutputFile) closePart() error {
+	err := o.w.Flush()
+	if o.z != nil {
+		if zerr := o.z.Close(); err == nil {
+			err = zerr
+		}
+	}
+	if o.Name == Stdout {
+		return err
+	}
+	if ferr := o.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// parseSize parses a size in bytes, optionally followed by a KB, MB or
+// GB unit, e.g. 100MB.
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+// existsParam returns the exists parameter of a sink, the default
+// ExistsTimestamp when not set.
+func existsParam(params map[string]string) (string, error) {
+	e := params["exists"]
+	switch e {
+	case "":
+		return ExistsTimestamp, nil
+	case ExistsTimestamp, ExistsRefuse, ExistsOverwrite:
+		return e, nil
+	}
+	return "", fmt.Errorf("invalid exists %q, use %s, %s or %s", e, ExistsTimestamp, ExistsRefuse, ExistsOverwrite)
+}
+
+// outputFileKeys are the parameters of the sinks writing an OutputFile.
+var outputFileKeys = []string{"exists", "compress", "rotate", "records"}
+
+// outputFileParams sets the options of an output file from the
+// exists, compress, rotate and records parameters of a sink.
+func outputFileParams(o *OutputFile, params map[string]string) error {
+	e, err := existsParam(params)
+	if err != nil {
+		return err
+	}
+	o.Exists = e
+	o.Compress = params["compress"]
+	if r := params["rotate"]; r != "" {
+		n, err := parseSize(r)
+		if err != nil {
+			return err
+		}
+		o.MaxBytes = n
+	}
+	if r := params["records"]; r != "" {
+		n, err := strconv.Atoi(r)
+		if err != nil {
+			return fmt.Errorf("invalid records %q", r)
+		}
+		o.MaxRecords = n
+	}
+	return nil
+}
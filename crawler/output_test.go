@@ -0,0 +1,217 @@
+package crawler
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputName(t *testing.T) {
+	u, _ := url.Parse("https://tess.elixir-europe.org:8080/events/")
+	date := time.Date(2018, 6, 1, 10, 5, 0, 0, time.UTC)
+
+	if n := OutputName(DefaultOutputTemplate, u, date); n != "tess.elixir-europe.org-8080_events_schema.jsonl" {
+		t.Errorf("Unexpected output name %s", n)
+	}
+	if n := OutputName("out/{host}/{date}/{time}.jsonl.gz", u, date); n != "out/tess.elixir-europe.org-8080/2018-06-01/100500.jsonl.gz" {
+		t.Errorf("Unexpected output name %s", n)
+	}
+
+	base, ext := splitOutputName("out/schema.jsonl.zst")
+	if base != "out/schema" || ext != ".jsonl.zst" {
+		t.Errorf("Unexpected split %s %s", base, ext)
+	}
+}
+
+func TestOutputFileExists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "sub", "out.jsonl")
+	o := NewOutputFile(name)
+	if err := o.Open(); err != nil {
+		t.Fatal(err)
+	}
+	o.WriteRecord([]byte("first\n"))
+	o.Close()
+
+	o = NewOutputFile(name)
+	if err := o.Open(); err != nil {
+		t.Fatal(err)
+	}
+	o.WriteRecord([]byte("second\n"))
+	o.Close()
+	if o.Name == name || !strings.HasSuffix(o.Name, ".jsonl") {
+		t.Errorf("Expecting a timestamped file name, got %s", o.Name)
+	}
+	if b, _ := ioutil.ReadFile(name); string(b) != "first\n" {
+		t.Errorf("Expecting the existing file to be kept, got %q", b)
+	}
+
+	o = NewOutputFile(name)
+	o.Exists = ExistsRefuse
+	if err := o.Open(); err == nil {
+		t.Errorf("Expecting an error for an existing file")
+	}
+
+	o = NewOutputFile(name)
+	o.Exists = ExistsOverwrite
+	if err := o.Open(); err != nil {
+		t.Fatal(err)
+	}
+	o.WriteRecord([]byte("third\n"))
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Close(); err != nil {
+		t.Errorf("Expecting a second close to do nothing, got %s", err)
+	}
+	if b, _ := ioutil.ReadFile(name); string(b) != "third\n" {
+		t.Errorf("Expecting the file to be overwritten, got %q", b)
+	}
+}
+
+func TestOutputFileRotationAndCompression(t *testing.T) {
+	dir, err := ioutil.TempDir("", "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	o := NewOutputFile(filepath.Join(dir, "out.jsonl"))
+	o.Compress = CompressGzip
+	o.MaxRecords = 2
+	if err := o.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []string{"1\n", "2\n", "3\n", "4\n", "5\n"} {
+		if err := o.WriteRecord([]byte(r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{"out.jsonl.gz": "1\n2\n", "out.1.jsonl.gz": "3\n4\n", "out.2.jsonl.gz": "5\n"} {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("Expecting file %s: %v", name, err)
+			continue
+		}
+		z, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(z)
+		f.Close()
+		if string(b) != expected {
+			t.Errorf("Expecting %q on %s but got %q", expected, name, b)
+		}
+	}
+
+	if n, err := parseSize("100MB"); err != nil || n != 100<<20 {
+		t.Errorf("Unexpected size %d %v", n, err)
+	}
+}
+
+func TestOutputFileLeftoverPart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "out.jsonl")
+	leftover := filepath.Join(dir, "out.1.jsonl")
+	ioutil.WriteFile(leftover, []byte("old\n"), 0644)
+
+	o := NewOutputFile(name)
+	o.MaxRecords = 1
+	if err := o.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []string{"1\n", "2\n", "3\n"} {
+		if err := o.WriteRecord([]byte(r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	o.Close()
+	if o.Name == name {
+		t.Errorf("Expecting a timestamped file name, got %s", o.Name)
+	}
+	if b, _ := ioutil.ReadFile(leftover); string(b) != "old\n" {
+		t.Errorf("Expecting the leftover part to be kept, got %q", b)
+	}
+
+	o = NewOutputFile(name)
+	o.MaxRecords = 1
+	o.Exists = ExistsRefuse
+	if err := o.Open(); err == nil {
+		t.Errorf("Expecting an error for an existing part")
+	}
+
+	// the parts of an earlier, longer output are removed on overwrite
+	stale := filepath.Join(dir, "out.3.jsonl")
+	ioutil.WriteFile(stale, []byte("old\n"), 0644)
+	o = NewOutputFile(name)
+	o.MaxRecords = 1
+	o.Exists = ExistsOverwrite
+	if err := o.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []string{"1\n", "2\n"} {
+		if err := o.WriteRecord([]byte(r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	o.Close()
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Expecting the earlier part %s to be removed", stale)
+	}
+	if b, _ := ioutil.ReadFile(leftover); string(b) != "2\n" {
+		t.Errorf("Expecting the first part to be overwritten, got %q", b)
+	}
+}
+
+func TestOutputFileStdout(t *testing.T) {
+	f, err := ioutil.TempFile("", "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	stdout := os.Stdout
+	os.Stdout = f
+	defer func() { os.Stdout = stdout }()
+
+	s := NewJSONLSink(Stdout)
+	s.Output.MaxRecords = 1
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	s.Write(Record{Page: "http://example.com/1"})
+	s.Write(Record{Page: "http://example.com/2"})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = stdout
+
+	if _, err := f.Write(nil); err != nil {
+		t.Errorf("Expecting stdout to be left open: %v", err)
+	}
+	f.Close()
+	b, _ := ioutil.ReadFile(f.Name())
+	expected := `{"version":1,"page":"http://example.com/1","block":0,"data":{}}` + "\n" + `{"version":1,"page":"http://example.com/2","block":0,"data":{}}` + "\n"
+	if string(b) != expected {
+		t.Errorf("Expecting %q but got %q", expected, b)
+	}
+}
@@ -0,0 +1,205 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Term types of an RDF term.
+const (
+	IRI       = "iri"
+	BlankNode = "bnode"
+	Literal   = "literal"
+)
+
+// Common vocabulary IRIs.
+const (
+	rdfNS          = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xsdNS          = "http://www.w3.org/2001/XMLSchema#"
+	rdfType        = rdfNS + "type"
+	rdfFirst       = rdfNS + "first"
+	rdfRest        = rdfNS + "rest"
+	rdfNil         = rdfNS + "nil"
+	rdfLangString  = rdfNS + "langString"
+	rdfXMLLiteral  = rdfNS + "XMLLiteral"
+	xsdString      = xsdNS + "string"
+	xsdBoolean     = xsdNS + "boolean"
+	xsdInteger     = xsdNS + "integer"
+	xsdDecimal     = xsdNS + "decimal"
+	xsdDouble      = xsdNS + "double"
+	schemaOrgVocab = "http://schema.org/"
+)
+
+// Term is an RDF term: an IRI, a blank node or a literal.
+type Term struct {
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	Datatype string `json:"datatype,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+// Triple is an RDF statement.
+type Triple struct {
+	Subject   Term `json:"subject"`
+	Predicate Term `json:"predicate"`
+	Object    Term `json:"object"`
+}
+
+// NewIRI creates an IRI term.
+func NewIRI(iri string) Term {
+	return Term{Type: IRI, Value: iri}
+}
+
+// NewBlankNode creates a blank node term with the given label.
+func NewBlankNode(label string) Term {
+	return Term{Type: BlankNode, Value: label}
+}
+
+// NewLiteral creates a literal term. Literals with a language tag get
+// the rdf:langString datatype and plain literals the xsd:string one.
+func NewLiteral(value, datatype, language string) Term {
+	if language != "" {
+		return Term{Type: Literal, Value: value, Datatype: rdfLangString, Language: strings.ToLower(language)}
+	}
+	if datatype == "" {
+		datatype = xsdString
+	}
+	return Term{Type: Literal, Value: value, Datatype: datatype}
+}
+
+// String returns the term in N-Triples syntax.
+func (t Term) String() string {
+	switch t.Type {
+	case IRI:
+		return "<" + escapeIRI(t.Value) + ">"
+	case BlankNode:
+		return "_:" + t.Value
+	}
+
+	s := `"` + escapeLiteral(t.Value) + `"`
+	if t.Language != "" {
+		return s + "@" + t.Language
+	}
+	if t.Datatype != "" && t.Datatype != xsdString {
+		return s + "^^<" + escapeIRI(t.Datatype) + ">"
+	}
+	return s
+}
+
+// String returns the triple as an N-Triples line without the line break.
+func (t Triple) String() string {
+	return fmt.Sprintf("%s %s %s .", t.Subject, t.Predicate, t.Object)
+}
+
+func escapeLiteral(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+func escapeIRI(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r <= 0x20 || strings.ContainsRune("<>\"{}|^`\\", r) {
+			fmt.Fprintf(&b, `\u%04X`, r)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// blankNodes hands out document scoped blank node labels, so the same
+// label used in a document maps to the same node while labels of
+// different documents never clash.
+type blankNodes struct {
+	prefix string
+	n      int
+	labels map[string]string
+}
+
+func newBlankNodes(prefix string) *blankNodes {
+	return &blankNodes{prefix: prefix, labels: make(map[string]string)}
+}
+
+// fresh returns a new anonymous blank node.
+func (b *blankNodes) fresh() Term {
+	l := fmt.Sprintf("%sb%d", b.prefix, b.n)
+	b.n++
+	return NewBlankNode(l)
+}
+
+// named returns the blank node for a label used in the document.
+func (b *blankNodes) named(label string) Term {
+	if l, ok := b.labels[label]; ok {
+		return NewBlankNode(l)
+	}
+	t := b.fresh()
+	b.labels[label] = t.Value
+	return t
+}
+
+// resolveIRI resolves a possibly relative IRI reference against a base IRI.
+func resolveIRI(base, ref string) string {
+	if base == "" {
+		return ref
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil || r.IsAbs() {
+		return ref
+	}
+	res := b.ResolveReference(r).String()
+	// url drops empty fragments, namespace IRIs often end with one
+	if strings.HasSuffix(ref, "#") && !strings.HasSuffix(res, "#") {
+		res += "#"
+	}
+	return res
+}
+
+// ParseRDF parses an RDF document of the given media type.
+// Relative IRIs are resolved against base.
+func ParseRDF(mediaType string, data []byte, base string) ([]Triple, error) {
+	return parseRDF(mediaType, data, base, newBlankNodes(""))
+}
+
+func parseRDF(mediaType string, data []byte, base string, bn *blankNodes) ([]Triple, error) {
+	switch mediaType {
+	case "text/turtle", "application/x-turtle", "text/n3", "application/trig":
+		return parseTurtle(string(data), base, bn)
+	case "application/n-triples", "application/n-quads":
+		return parseNTriples(string(data), bn)
+	case "application/rdf+xml":
+		return parseRDFXML(data, base, bn)
+	case "application/ld+json", "application/json":
+		d, err := decodeJSONLD(data)
+		if err != nil {
+			return nil, err
+		}
+		return jsonLDToRDF(d, base, bn), nil
+	}
+	return nil, fmt.Errorf("unsupported RDF media type %s", mediaType)
+}
@@ -0,0 +1,153 @@
+package crawler
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// Triples converts the metadata of a record to RDF. JSON-LD and
+// microdata records are converted, the triples of RDF and RDFa records
+// are returned as they are. Other records, like signposting links or
+// diagnostics, have no triples.
+//
+// Blank nodes are labelled after a hash of the record, so the same
+// metadata found on the same page always gets the same labels.
+func (r Record) Triples() []Triple {
+	if _, ok := r.Metadata["diagnostic"]; ok {
+		return nil
+	}
+	bn := newBlankNodes(r.blankNodePrefix())
+
+	switch r.Extractor {
+	case ExtractorJSONLD:
+		base := r.Source
+		if base == "" {
+			base = r.Page
+		}
+		return jsonLDToRDF(r.Metadata, base, bn)
+
+	case ExtractorMicrodata:
+		return microdataToRDF(r.Metadata, bn)
+
+	case ExtractorRDF, ExtractorRDFa:
+		ts, _ := r.Metadata["triples"].([]Triple)
+		res := make([]Triple, len(ts))
+		for i, t := range ts {
+			res[i] = Triple{relabel(t.Subject, bn), t.Predicate, relabel(t.Object, bn)}
+		}
+		return res
+	}
+	return nil
+}
+
+// blankNodePrefix returns the blank node label prefix of the record.
+func (r Record) blankNodePrefix() string {
+	h := sha1.New()
+	h.Write([]byte(r.Page + "\n" + r.Source + "\n" + r.Extractor + "\n"))
+	if j, err := json.Marshal(r.Metadata); err == nil {
+		h.Write(j)
+	}
+	return "n" + hex.EncodeToString(h.Sum(nil))[:12] + "_"
+}
+
+func relabel(t Term, bn *blankNodes) Term {
+	if t.Type == BlankNode {
+		return bn.named(t.Value)
+	}
+	return t
+}
+
+// microdataToRDF converts the microdata items of a page following the
+// Microdata to RDF note: item types and properties are expanded against
+// the vocabulary of the item type. The parsed microdata does not tell
+// URL property values apart, absolute http(s) URLs are taken as IRIs.
+func microdataToRDF(data map[string]interface{}, bn *blankNodes) []Triple {
+	var ts []Triple
+	emit := func(s, p, o Term) {
+		ts = append(ts, Triple{s, p, o})
+	}
+
+	items, _ := data["items"].([]interface{})
+	for _, i := range items {
+		if item, ok := i.(map[string]interface{}); ok {
+			microdataItem(item, "", bn, emit)
+		}
+	}
+	return ts
+}
+
+func microdataItem(item map[string]interface{}, vocab string, bn *blankNodes, emit func(s, p, o Term)) Term {
+	var s Term
+	if id, ok := item["id"].(string); ok && id != "" {
+		s = NewIRI(id)
+	} else {
+		s = bn.fresh()
+	}
+
+	types, _ := item["type"].([]interface{})
+	for i, t := range types {
+		typ, ok := t.(string)
+		if !ok {
+			continue
+		}
+		if i == 0 {
+			vocab = microdataVocabulary(typ)
+		}
+		emit(s, NewIRI(rdfType), NewIRI(typ))
+	}
+
+	props, _ := item["properties"].(map[string]interface{})
+	for _, name := range sortedKeys(props) {
+		p := microdataProperty(name, vocab)
+		if p == "" {
+			continue
+		}
+		values, _ := props[name].([]interface{})
+		for _, v := range values {
+			switch val := v.(type) {
+			case map[string]interface{}:
+				emit(s, NewIRI(p), microdataItem(val, vocab, bn, emit))
+			case string:
+				if isHTTPURL(val) {
+					emit(s, NewIRI(p), NewIRI(val))
+				} else {
+					emit(s, NewIRI(p), NewLiteral(val, "", ""))
+				}
+			}
+		}
+	}
+	return s
+}
+
+// microdataVocabulary returns the vocabulary of an item type, the type
+// IRI up to the last # or /.
+func microdataVocabulary(typ string) string {
+	if i := strings.LastIndex(typ, "#"); i >= 0 {
+		return typ[:i+1]
+	}
+	if i := strings.LastIndex(typ, "/"); i >= 0 {
+		return typ[:i+1]
+	}
+	return ""
+}
+
+func microdataProperty(name, vocab string) string {
+	if u, err := url.Parse(name); err == nil && u.IsAbs() {
+		return name
+	}
+	if vocab == "" {
+		return ""
+	}
+	return vocab + name
+}
+
+func isHTTPURL(s string) bool {
+	if strings.ContainsAny(s, " \t\r\n") {
+		return false
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
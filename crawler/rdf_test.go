@@ -0,0 +1,284 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func hasTriple(ts []Triple, s, p, o string) bool {
+	for _, t := range ts {
+		if t.Subject.String() == s && t.Predicate.String() == p && t.Object.String() == o {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParseTurtle(t *testing.T) {
+	ttl := `@prefix schema: <http://schema.org/> .
+	@base <http://example.com/> .
+	PREFIX ex: <http://example.com/ns#>
+
+	<ds1> a schema:Dataset ;
+		schema:name "Proteins"@en, 'Proteínas'@es ;
+		schema:size 12 ;
+		schema:keywords ( "a" "b" ) ;
+		schema:creator [ a schema:Person ; schema:name """Jane
+Doe""" ] ;
+		ex:valid true .
+	`
+
+	ts, err := parseTurtle(ttl, "", newBlankNodes(""))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	if !hasTriple(ts, "<http://example.com/ds1>", "<"+rdfType+">", "<http://schema.org/Dataset>") {
+		t.Errorf("Type triple not found on %v", ts)
+	}
+	if !hasTriple(ts, "<http://example.com/ds1>", "<http://schema.org/name>", `"Proteínas"@es`) {
+		t.Errorf("Language tagged literal not found")
+	}
+	if !hasTriple(ts, "<http://example.com/ds1>", "<http://schema.org/size>", `"12"^^<`+xsdInteger+`>`) {
+		t.Errorf("Integer literal not found")
+	}
+	if !hasTriple(ts, "_:b2", "<http://schema.org/name>", `"Jane\nDoe"`) {
+		t.Errorf("Long string literal not found")
+	}
+	if !hasTriple(ts, "<http://example.com/ds1>", "<http://example.com/ns#valid>", `"true"^^<`+xsdBoolean+`>`) {
+		t.Errorf("Boolean literal not found")
+	}
+	if len(ts) != 13 {
+		t.Errorf("Expecting 13 triples but got %d", len(ts))
+	}
+}
+
+func TestParseTurtleError(t *testing.T) {
+	_, err := parseTurtle("<a> <b> \"c\"\n<d> <e> <f> .", "", newBlankNodes(""))
+	if err == nil {
+		t.Fatalf("Expected a syntax error")
+	}
+
+	se, ok := err.(*RDFSyntaxError)
+	if !ok || se.Line != 2 {
+		t.Errorf("Expecting syntax error on line 2 but got %v", err)
+	}
+}
+
+func TestParseNQuads(t *testing.T) {
+	nq := `<http://example.com/a> <http://schema.org/name> "A\tB" <http://example.com/g> .
+_:x <http://schema.org/about> <http://example.com/a> .
+# comment
+`
+	ts, err := parseNTriples(nq, newBlankNodes(""))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if len(ts) != 2 {
+		t.Errorf("Expecting 2 triples but got %d", len(ts))
+	}
+	if ts[0].Object.Value != "A\tB" {
+		t.Errorf("Expecting escaped tab in literal but got %q", ts[0].Object.Value)
+	}
+}
+
+func TestParseRDFXML(t *testing.T) {
+	x := `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+         xmlns:schema="http://schema.org/"
+         xml:base="http://example.com/">
+  <schema:Dataset rdf:about="ds1" schema:name="Proteins">
+    <schema:license rdf:resource="http://creativecommons.org/licenses/by/4.0/"/>
+    <schema:size rdf:datatype="http://www.w3.org/2001/XMLSchema#integer">12</schema:size>
+    <schema:creator>
+      <schema:Person>
+        <schema:name xml:lang="en">Jane</schema:name>
+      </schema:Person>
+    </schema:creator>
+  </schema:Dataset>
+</rdf:RDF>`
+
+	ts, err := parseRDFXML([]byte(x), "", newBlankNodes(""))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	if !hasTriple(ts, "<http://example.com/ds1>", "<"+rdfType+">", "<http://schema.org/Dataset>") {
+		t.Errorf("Type triple not found on %v", ts)
+	}
+	if !hasTriple(ts, "<http://example.com/ds1>", "<http://schema.org/name>", `"Proteins"`) {
+		t.Errorf("Property attribute not found")
+	}
+	if !hasTriple(ts, "<http://example.com/ds1>", "<http://schema.org/license>", "<http://creativecommons.org/licenses/by/4.0/>") {
+		t.Errorf("Resource property not found")
+	}
+	if !hasTriple(ts, "_:b0", "<http://schema.org/name>", `"Jane"@en`) {
+		t.Errorf("Nested node property not found on %v", ts)
+	}
+}
+
+func TestJSONLDToRDF(t *testing.T) {
+	doc, err := decodeJSONLD([]byte(`{
+		"@context": "https://schema.org",
+		"@type": "Dataset",
+		"@id": "ds1",
+		"name": "Proteins",
+		"size": 12,
+		"isAccessibleForFree": true,
+		"creator": {"@type": "Person", "name": "Jane"},
+		"url": {"@id": "http://example.com/ds1.html"},
+		"http://purl.org/dc/terms/conformsTo": {"@id": "https://bioschemas.org/profiles/Dataset/1.0-RELEASE"}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	ts := jsonLDToRDF(doc, "http://example.com/", newBlankNodes(""))
+
+	if !hasTriple(ts, "<http://example.com/ds1>", "<"+rdfType+">", "<http://schema.org/Dataset>") {
+		t.Errorf("Type triple not found on %v", ts)
+	}
+	if !hasTriple(ts, "<http://example.com/ds1>", "<http://schema.org/size>", `"12"^^<`+xsdInteger+`>`) {
+		t.Errorf("Integer literal not found")
+	}
+	if !hasTriple(ts, "_:b0", "<http://schema.org/name>", `"Jane"`) {
+		t.Errorf("Nested node not found on %v", ts)
+	}
+	if !hasTriple(ts, "<http://example.com/ds1>", "<http://schema.org/url>", "<http://example.com/ds1.html>") {
+		t.Errorf("Node reference not found")
+	}
+	if !hasTriple(ts, "<http://example.com/ds1>", "<http://purl.org/dc/terms/conformsTo>", "<https://bioschemas.org/profiles/Dataset/1.0-RELEASE>") {
+		t.Errorf("Absolute IRI property not found")
+	}
+}
+
+func TestJSONLDToRDFGraphAndPrefixes(t *testing.T) {
+	d, _ := decodeJSONLD([]byte(`{
+		"@context": {"s": "http://schema.org/", "name": "s:name", "homepage": {"@id": "s:url", "@type": "@id"}},
+		"@graph": [
+			{"@id": "_:a", "@type": "s:Person", "name": "Ann", "homepage": "http://example.com/ann"},
+			{"@type": "s:Person", "s:knows": {"@id": "_:a"}}
+		]
+	}`))
+
+	ts := jsonLDToRDF(d, "", newBlankNodes(""))
+
+	if !hasTriple(ts, "_:b0", "<http://schema.org/url>", "<http://example.com/ann>") {
+		t.Errorf("Typed term not found on %v", ts)
+	}
+	if !hasTriple(ts, "_:b1", "<http://schema.org/knows>", "_:b0") {
+		t.Errorf("Blank node reference not found on %v", ts)
+	}
+}
+
+func TestExtractRDFa(t *testing.T) {
+	page := `<html><body vocab="http://schema.org/">
+	<div typeof="Dataset" resource="/ds1">
+		<h1 property="name">Proteins</h1>
+		<a property="url" href="/ds1/download">download</a>
+		<div property="creator" typeof="Person"><span property="name">Jane</span></div>
+		<meta property="dc:issued" content="2018-01-01">
+	</div>
+	</body></html>`
+
+	base, _ := url.Parse("http://example.com/page")
+	ts, err := extractRDFa(page, base)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	if !hasTriple(ts, "<http://example.com/ds1>", "<"+rdfType+">", "<http://schema.org/Dataset>") {
+		t.Errorf("Type triple not found on %v", ts)
+	}
+	if !hasTriple(ts, "<http://example.com/ds1>", "<http://schema.org/url>", "<http://example.com/ds1/download>") {
+		t.Errorf("IRI property not found on %v", ts)
+	}
+	if !hasTriple(ts, "<http://example.com/ds1>", "<http://purl.org/dc/terms/issued>", `"2018-01-01"`) {
+		t.Errorf("Prefixed property not found on %v", ts)
+	}
+	if !hasTriple(ts, "<http://example.com/ds1>", "<http://schema.org/creator>", "_:b0") ||
+		!hasTriple(ts, "_:b0", "<http://schema.org/name>", `"Jane"`) {
+		t.Errorf("Nested item not found on %v", ts)
+	}
+	if len(ts) != 7 {
+		t.Errorf("Expecting 7 triples but got %d", len(ts))
+	}
+}
+
+func TestRecordTriples(t *testing.T) {
+	r := Record{Page: "http://example.com/page", Extractor: ExtractorMicrodata, Metadata: map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{
+				"type": []interface{}{"http://schema.org/Dataset"},
+				"properties": map[string]interface{}{
+					"name": []interface{}{"Proteins"},
+					"url":  []interface{}{"http://example.com/ds1"},
+					"creator": []interface{}{map[string]interface{}{
+						"properties": map[string]interface{}{"name": []interface{}{"Jane"}},
+					}},
+				},
+			},
+		},
+	}}
+
+	ts := r.Triples()
+	if len(ts) != 5 {
+		t.Fatalf("Expecting 5 triples but got %d: %v", len(ts), ts)
+	}
+	ds := ts[0].Subject.String()
+	if !hasTriple(ts, ds, "<http://schema.org/url>", "<http://example.com/ds1>") {
+		t.Errorf("URL property not found on %v", ts)
+	}
+	if !hasTriple(ts, ds, "<http://schema.org/name>", `"Proteins"`) {
+		t.Errorf("Text property not found on %v", ts)
+	}
+
+	again := r.Triples()
+	for i := range ts {
+		if ts[i] != again[i] {
+			t.Errorf("Expecting the same blank node labels but got %s and %s", ts[i], again[i])
+		}
+	}
+
+	other := r
+	other.Page = "http://example.com/other"
+	if other.Triples()[0].Subject == ts[0].Subject {
+		t.Errorf("Expecting different blank node labels for different pages")
+	}
+
+	diag := Record{Page: r.Page, Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"diagnostic": "error"}}
+	if len(diag.Triples()) != 0 {
+		t.Errorf("Expecting no triples for a diagnostic record")
+	}
+}
+
+func TestWriteTurtle(t *testing.T) {
+	s := NewIRI("http://example.com/ds1")
+	ts := []Triple{
+		{s, NewIRI(schemaOrgVocab + "name"), NewLiteral("Proteins", "", "en")},
+		{s, NewIRI(rdfType), NewIRI(schemaOrgVocab + "Dataset")},
+		{s, NewIRI(schemaOrgVocab + "size"), NewLiteral("12", xsdInteger, "")},
+	}
+
+	var b strings.Builder
+	if err := writeTurtle(&b, ts); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	expected := `@prefix rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#> .
+@prefix schema: <http://schema.org/> .
+@prefix xsd: <http://www.w3.org/2001/XMLSchema#> .
+
+<http://example.com/ds1> a schema:Dataset ;
+	schema:name "Proteins"@en ;
+	schema:size "12"^^xsd:integer .
+`
+	if b.String() != expected {
+		t.Errorf("Unexpected Turtle output:\n%s", b.String())
+	}
+
+	parsed, err := parseTurtle(b.String(), "", newBlankNodes(""))
+	if err != nil || len(parsed) != 3 {
+		t.Errorf("Expecting the output to parse back to 3 triples, got %d %v", len(parsed), err)
+	}
+}
@@ -0,0 +1,216 @@
+package crawler
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// rdfaPrefixes is the subset of the RDFa initial context prefixes
+// recognised without a prefix declaration.
+var rdfaPrefixes = map[string]string{
+	"dc":      "http://purl.org/dc/terms/",
+	"dcat":    "http://www.w3.org/ns/dcat#",
+	"dcterms": "http://purl.org/dc/terms/",
+	"foaf":    "http://xmlns.com/foaf/0.1/",
+	"og":      "http://ogp.me/ns#",
+	"owl":     "http://www.w3.org/2002/07/owl#",
+	"rdf":     rdfNS,
+	"rdfs":    "http://www.w3.org/2000/01/rdf-schema#",
+	"schema":  schemaOrgVocab,
+	"skos":    "http://www.w3.org/2004/02/skos/core#",
+	"xsd":     xsdNS,
+}
+
+// rdfaScope is the evaluation context inherited by an element.
+type rdfaScope struct {
+	subject  Term
+	vocab    string
+	prefixes map[string]string
+	language string
+}
+
+type rdfaParser struct {
+	base    string
+	bn      *blankNodes
+	triples []Triple
+}
+
+// extractRDFa extracts the RDFa Lite 1.1 statements of an HTML page:
+// vocab, prefix, typeof, property and resource, plus the about, href,
+// src, content and datatype attributes commonly used with them.
+func extractRDFa(doc string, base *url.URL) ([]Triple, error) {
+	root, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &rdfaParser{base: base.String(), bn: newBlankNodes("")}
+	p.element(root, rdfaScope{subject: NewIRI(p.base), prefixes: rdfaPrefixes})
+	return p.triples, nil
+}
+
+func (p *rdfaParser) emit(s, pr, o Term) {
+	p.triples = append(p.triples, Triple{s, pr, o})
+}
+
+func (p *rdfaParser) element(n *html.Node, sc rdfaScope) {
+	if n.Type == html.ElementNode {
+		sc = p.scope(n, sc)
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		p.element(child, sc)
+	}
+}
+
+// scope emits the statements of an element and returns the scope of
+// its children.
+func (p *rdfaParser) scope(n *html.Node, sc rdfaScope) rdfaScope {
+	if v, ok := getAttr("vocab", n); ok {
+		sc.vocab = ""
+		if v = strings.TrimSpace(v); v != "" {
+			sc.vocab = resolveIRI(p.base, v)
+		}
+	}
+	if v, ok := getAttr("prefix", n); ok {
+		sc.prefixes = p.declarePrefixes(sc.prefixes, v)
+	}
+	if v, ok := getAttr("lang", n); ok {
+		sc.language = v
+	}
+	if v, ok := getAttr("xml:lang", n); ok {
+		sc.language = v
+	}
+
+	about, hasAbout := getAttr("about", n)
+	typeof, hasTypeof := getAttr("typeof", n)
+	property, hasProperty := getAttr("property", n)
+	resource, hasResource := p.resource(n)
+
+	parent := sc.subject
+	subject := parent
+	if hasAbout {
+		subject = NewIRI(resolveIRI(p.base, about))
+	}
+
+	var typed Term
+	if hasTypeof {
+		switch {
+		case hasAbout:
+			typed = subject
+		case hasResource:
+			typed = NewIRI(resource)
+		default:
+			typed = p.bn.fresh()
+		}
+		for _, t := range strings.Fields(typeof) {
+			if iri := sc.expand(t); iri != "" {
+				p.emit(typed, NewIRI(rdfType), NewIRI(iri))
+			}
+		}
+	}
+
+	if hasProperty {
+		var object Term
+		switch {
+		case hasTypeof && !hasAbout:
+			subject = parent
+			object = typed
+		case hasResource:
+			if _, ok := getAttr("content", n); !ok {
+				object = NewIRI(resource)
+				break
+			}
+			fallthrough
+		default:
+			object = p.literal(n, sc)
+		}
+
+		for _, pr := range strings.Fields(property) {
+			if iri := sc.expand(pr); iri != "" {
+				p.emit(subject, NewIRI(iri), object)
+			}
+		}
+	}
+
+	switch {
+	case hasTypeof:
+		sc.subject = typed
+	case hasAbout:
+		sc.subject = subject
+	}
+	return sc
+}
+
+// resource returns the resolved IRI an element refers to.
+func (p *rdfaParser) resource(n *html.Node) (string, bool) {
+	for _, a := range []string{"resource", "href", "src"} {
+		if v, ok := getAttr(a, n); ok {
+			return resolveIRI(p.base, strings.TrimSpace(v)), true
+		}
+	}
+	return "", false
+}
+
+// literal returns the literal value of a property element.
+func (p *rdfaParser) literal(n *html.Node, sc rdfaScope) Term {
+	var value string
+	if v, ok := getAttr("content", n); ok {
+		value = v
+	} else if v, ok := getAttr("datetime", n); ok && n.DataAtom == atom.Time {
+		value = v
+	} else {
+		var text bytes.Buffer
+		walk(n, func(c *html.Node) {
+			if c.Type == html.TextNode {
+				text.WriteString(c.Data)
+			}
+		})
+		value = text.String()
+	}
+
+	if dt, ok := getAttr("datatype", n); ok && strings.TrimSpace(dt) != "" {
+		return NewLiteral(value, sc.expand(strings.TrimSpace(dt)), "")
+	}
+	return NewLiteral(value, "", sc.language)
+}
+
+// declarePrefixes adds the mappings of a prefix attribute, given as
+// "prefix: iri" pairs, to the ones in scope.
+func (p *rdfaParser) declarePrefixes(current map[string]string, decl string) map[string]string {
+	prefixes := make(map[string]string, len(current))
+	for k, v := range current {
+		prefixes[k] = v
+	}
+
+	f := strings.Fields(decl)
+	for i := 0; i+1 < len(f); i += 2 {
+		if !strings.HasSuffix(f[i], ":") {
+			continue
+		}
+		prefixes[strings.ToLower(strings.TrimSuffix(f[i], ":"))] = f[i+1]
+	}
+	return prefixes
+}
+
+// expand returns the IRI of a term, compact IRI or absolute IRI, or an
+// empty string when it can not be expanded.
+func (sc rdfaScope) expand(term string) string {
+	if i := strings.Index(term, ":"); i >= 0 {
+		if ns, ok := sc.prefixes[strings.ToLower(term[:i])]; ok {
+			return ns + term[i+1:]
+		}
+		if u, err := url.Parse(term); err == nil && u.IsAbs() {
+			return term
+		}
+		return ""
+	}
+	if sc.vocab == "" {
+		return ""
+	}
+	return sc.vocab + term
+}
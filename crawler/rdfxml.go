@@ -0,0 +1,248 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+const xmlNS = "http://www.w3.org/XML/1998/namespace"
+
+// xmlNode is a minimal element tree built from the XML token stream.
+type xmlNode struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     string
+	inner    string
+}
+
+func (n *xmlNode) attr(space, local string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+func (n *xmlNode) iri() string {
+	return n.name.Space + n.name.Local
+}
+
+func (n *xmlNode) isRDF(local string) bool {
+	return n.name.Space == rdfNS && n.name.Local == local
+}
+
+func readXMLTree(data []byte) (*xmlNode, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+
+	var stack []*xmlNode
+	var root *xmlNode
+	var starts []int64
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name, attrs: t.Copy().Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+			starts = append(starts, d.InputOffset())
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unbalanced end element %s", t.Name.Local)
+			}
+			n := stack[len(stack)-1]
+			start := starts[len(starts)-1]
+			if end := bytes.LastIndex(data[start:d.InputOffset()], []byte("</")); end >= 0 {
+				n.inner = string(data[start : start+int64(end)])
+			}
+			stack = stack[:len(stack)-1]
+			starts = starts[:len(starts)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("empty XML document")
+	}
+	return root, nil
+}
+
+// rdfXMLParser turns an RDF/XML element tree into triples.
+// It covers node and property elements, rdf:about, rdf:ID, rdf:nodeID,
+// rdf:resource, rdf:datatype, property attributes, rdf:li and the
+// Resource, Literal and Collection parse types.
+type rdfXMLParser struct {
+	bn      *blankNodes
+	triples []Triple
+}
+
+func parseRDFXML(data []byte, base string, bn *blankNodes) ([]Triple, error) {
+	root, err := readXMLTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &rdfXMLParser{bn: bn}
+	if root.isRDF("RDF") {
+		base, lang := scope(root, base, "")
+		for _, n := range root.children {
+			p.nodeElement(n, base, lang)
+		}
+	} else {
+		p.nodeElement(root, base, "")
+	}
+	return p.triples, nil
+}
+
+func (p *rdfXMLParser) emit(s, pr, o Term) {
+	p.triples = append(p.triples, Triple{s, pr, o})
+}
+
+// scope applies the xml:base and xml:lang attributes of an element.
+func scope(n *xmlNode, base, lang string) (string, string) {
+	if b, ok := n.attr(xmlNS, "base"); ok {
+		base = resolveIRI(base, b)
+	}
+	if l, ok := n.attr(xmlNS, "lang"); ok {
+		lang = l
+	}
+	return base, lang
+}
+
+func (p *rdfXMLParser) nodeElement(n *xmlNode, base, lang string) Term {
+	base, lang = scope(n, base, lang)
+
+	var s Term
+	if about, ok := n.attr(rdfNS, "about"); ok {
+		s = NewIRI(resolveIRI(base, about))
+	} else if id, ok := n.attr(rdfNS, "ID"); ok {
+		s = NewIRI(resolveIRI(base, "#"+id))
+	} else if nodeID, ok := n.attr(rdfNS, "nodeID"); ok {
+		s = p.bn.named(nodeID)
+	} else {
+		s = p.bn.fresh()
+	}
+
+	if !n.isRDF("Description") {
+		p.emit(s, NewIRI(rdfType), NewIRI(n.iri()))
+	}
+
+	p.propertyAttributes(s, n, base, lang)
+
+	li := 1
+	for _, c := range n.children {
+		pr := c.iri()
+		if c.isRDF("li") {
+			pr = fmt.Sprintf("%s_%d", rdfNS, li)
+			li++
+		}
+		p.propertyElement(s, NewIRI(pr), c, base, lang)
+	}
+	return s
+}
+
+// propertyAttributes emits the triples of the attributes that are not
+// part of the RDF/XML syntax itself.
+func (p *rdfXMLParser) propertyAttributes(s Term, n *xmlNode, base, lang string) {
+	for _, a := range n.attrs {
+		switch {
+		case a.Name.Space == xmlNS || a.Name.Space == "xmlns" || a.Name.Local == "xmlns" || a.Name.Space == "":
+			continue
+		case a.Name.Space == rdfNS:
+			if a.Name.Local == "type" {
+				p.emit(s, NewIRI(rdfType), NewIRI(resolveIRI(base, a.Value)))
+			}
+			continue
+		}
+		p.emit(s, NewIRI(a.Name.Space+a.Name.Local), NewLiteral(a.Value, "", lang))
+	}
+}
+
+func (p *rdfXMLParser) propertyElement(s, pr Term, n *xmlNode, base, lang string) {
+	base, lang = scope(n, base, lang)
+
+	parseType, _ := n.attr(rdfNS, "parseType")
+	switch parseType {
+	case "Resource":
+		o := p.bn.fresh()
+		p.emit(s, pr, o)
+		for _, c := range n.children {
+			p.propertyElement(o, NewIRI(c.iri()), c, base, lang)
+		}
+		return
+	case "Literal":
+		p.emit(s, pr, NewLiteral(n.inner, rdfXMLLiteral, ""))
+		return
+	case "Collection":
+		var items []Term
+		for _, c := range n.children {
+			items = append(items, p.nodeElement(c, base, lang))
+		}
+		p.emit(s, pr, emitList(items, p.bn, p.emit))
+		return
+	}
+
+	if len(n.children) > 0 {
+		p.emit(s, pr, p.nodeElement(n.children[0], base, lang))
+		return
+	}
+
+	if res, ok := n.attr(rdfNS, "resource"); ok {
+		o := NewIRI(resolveIRI(base, res))
+		p.emit(s, pr, o)
+		p.propertyAttributes(o, n, base, lang)
+		return
+	}
+	if nodeID, ok := n.attr(rdfNS, "nodeID"); ok {
+		o := p.bn.named(nodeID)
+		p.emit(s, pr, o)
+		p.propertyAttributes(o, n, base, lang)
+		return
+	}
+
+	if hasPropertyAttributes(n) {
+		o := p.bn.fresh()
+		p.emit(s, pr, o)
+		p.propertyAttributes(o, n, base, lang)
+		return
+	}
+
+	if dt, ok := n.attr(rdfNS, "datatype"); ok {
+		p.emit(s, pr, NewLiteral(n.text, resolveIRI(base, dt), ""))
+		return
+	}
+	p.emit(s, pr, NewLiteral(n.text, "", lang))
+}
+
+func hasPropertyAttributes(n *xmlNode) bool {
+	for _, a := range n.attrs {
+		if a.Name.Space == xmlNS || a.Name.Space == "xmlns" || a.Name.Local == "xmlns" || a.Name.Space == "" {
+			continue
+		}
+		if a.Name.Space == rdfNS && a.Name.Local != "type" {
+			continue
+		}
+		return true
+	}
+	return false
+}
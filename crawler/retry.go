@@ -0,0 +1,123 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Retry is how a sink retries the requests to its service that fail
+// with a network error, a server error or a 429 status. A request is
+// retried Retries times, waiting RetryWait the first time and twice as
+// long every next one, or what the service asks for on a Retry-After
+// header, but never more than MaxRetryWait as the crawl waits meanwhile.
+type Retry struct {
+	Retries      int
+	RetryWait    time.Duration
+	MaxRetryWait time.Duration
+}
+
+// DefaultRetry is the retry policy of the sinks unless set otherwise.
+var DefaultRetry = Retry{Retries: 3, RetryWait: time.Second, MaxRetryWait: 30 * time.Second}
+
+// attempt sends a request once. It tells whether a failed request is
+// worth retrying, and how long the service asked to wait, 0 when it
+// did not.
+type attempt func() (bool, time.Duration, error)
+
+// do sends a request until it succeeds, fails for good or runs out of
+// retries. The retries are logged with fields, as what failed.
+func (rt Retry) do(what string, fields log.Fields, send attempt) error {
+	wait := rt.RetryWait
+	for n := 0; ; n++ {
+		retry, after, err := send()
+		if err == nil || !retry || n >= rt.Retries {
+			return err
+		}
+
+		if after > 0 {
+			wait = after
+		}
+		if rt.MaxRetryWait > 0 && wait > rt.MaxRetryWait {
+			wait = rt.MaxRetryWait
+		}
+		log.WithFields(fields).WithFields(log.Fields{
+			"Attempt": n + 1,
+			"Error":   err,
+		}).Warn(what, " failed, retrying in ", wait)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// retryable tells whether a request that got the status is worth
+// retrying, 0 being a network error.
+func retryable(status int) bool {
+	return status == 0 || status >= 500 || status == http.StatusTooManyRequests
+}
+
+// retryAfter returns the wait asked for on the Retry-After header of a
+// response, in seconds, 0 when there is none.
+func retryAfter(h http.Header) time.Duration {
+	if secs, err := strconv.Atoi(h.Get("Retry-After")); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return 0
+}
+
+// retryKeys are the parameters of the sinks retrying their requests.
+var retryKeys = []string{"retries", "maxwait"}
+
+// retryParams sets the retries and maxwait parameters of a sink.
+func retryParams(rt *Retry, sink string, params map[string]string) error {
+	var err error
+	if v := params["retries"]; v != "" {
+		if rt.Retries, err = strconv.Atoi(v); err != nil || rt.Retries < 0 {
+			return fmt.Errorf("invalid %s retries %q", sink, v)
+		}
+	}
+	if v := params["maxwait"]; v != "" {
+		if rt.MaxRetryWait, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("invalid %s maxwait %q, e.g. 30s", sink, v)
+		}
+	}
+	return nil
+}
+
+// deadLetter is the file a sink appends what it could not deliver to,
+// to be sent again later. It is only created on the first failure.
+type deadLetter struct {
+	o *OutputFile
+}
+
+// write appends the entries to the file of the given name, what they
+// are being logged when it is created.
+func (d *deadLetter) write(name, what string, entries ...[]byte) error {
+	if d.o == nil {
+		o := NewOutputFile(name)
+		if err := o.Open(); err != nil {
+			return err
+		}
+		log.Warn("Writing ", what, " to ", o.Name)
+		d.o = o
+	}
+	for _, e := range entries {
+		if err := d.o.WriteRecord(e); err != nil {
+			return err
+		}
+	}
+	return d.o.Flush()
+}
+
+// close closes the file, if it was created.
+func (d *deadLetter) close() error {
+	if d.o == nil {
+		return nil
+	}
+	err := d.o.Close()
+	d.o = nil
+	return err
+}
@@ -0,0 +1,63 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	rt := Retry{Retries: 2, RetryWait: time.Millisecond, MaxRetryWait: 5 * time.Millisecond}
+
+	// the wait asked for by the service is capped
+	calls := 0
+	start := time.Now()
+	err := rt.do("Request", nil, func() (bool, time.Duration, error) {
+		calls++
+		if calls < 3 {
+			return true, time.Hour, fmt.Errorf("unavailable")
+		}
+		return false, 0, nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("Expecting success on the last retry, got %v after %d calls", err, calls)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expecting the waits to be capped, took %s", d)
+	}
+
+	calls = 0
+	err = rt.do("Request", nil, func() (bool, time.Duration, error) {
+		calls++
+		return true, 0, fmt.Errorf("unavailable")
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("Expecting an error after 2 retries, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	err = rt.do("Request", nil, func() (bool, time.Duration, error) {
+		calls++
+		return false, 0, fmt.Errorf("bad request")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expecting no retry of a bad request, got %v after %d calls", err, calls)
+	}
+
+	h := http.Header{}
+	h.Set("Retry-After", "120")
+	if d := retryAfter(h); d != 2*time.Minute {
+		t.Errorf("Unexpected Retry-After wait %s", d)
+	}
+	if !retryable(0) || !retryable(http.StatusTooManyRequests) || retryable(http.StatusBadRequest) {
+		t.Errorf("Unexpected retryable statuses")
+	}
+
+	if err := retryParams(&rt, "test", map[string]string{"retries": "5", "maxwait": "1m"}); err != nil || rt.Retries != 5 || rt.MaxRetryWait != time.Minute {
+		t.Errorf("Unexpected retry parameters %v %v", rt, err)
+	}
+	if err := retryParams(&rt, "test", map[string]string{"maxwait": "soon"}); err == nil {
+		t.Errorf("Expecting an error for an invalid maxwait")
+	}
+}
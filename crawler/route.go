@@ -0,0 +1,343 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Validation results of a record.
+const (
+	Valid    = "valid"
+	Repaired = "repaired"
+	Invalid  = "invalid"
+)
+
+// Validation tells whether the metadata of the record was valid,
+// had to be repaired, or could not be parsed at all and the record is
+// a diagnostic.
+func (r Record) Validation() string {
+	switch {
+	case r.Metadata["diagnostic"] != nil:
+		return Invalid
+	case len(r.Repairs) > 0:
+		return Repaired
+	}
+	return Valid
+}
+
+// Route dispatches the entities matching every one of its criteria to
+// the named sinks. Types are the accepted @type, Hosts the accepted page
+// hosts, which can use wildcards as in *.ebi.ac.uk, URL a regular
+// expression the page URL must match and Validation the accepted
+// validation results. An empty criterion matches every entity.
+type Route struct {
+	Types      []string `json:"type"`
+	Hosts      []string `json:"host"`
+	URL        string   `json:"url"`
+	Validation []string `json:"validation"`
+	Sinks      []string `json:"sinks"`
+	// Continue goes on with the next routes once an entity matches, by
+	// default it is only dispatched by the first route it matches.
+	Continue bool `json:"continue"`
+
+	url *regexp.Regexp
+}
+
+// matches tells whether the route accepts a record.
+func (rt *Route) matches(r Record, host string) bool {
+	if len(rt.Types) > 0 {
+		found := false
+		for _, e := range r.Entities() {
+			for _, t := range e.Types {
+				for _, rtt := range rt.Types {
+					if shortType(rtt) == t {
+						found = true
+					}
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(rt.Hosts) > 0 {
+		found := false
+		for _, h := range rt.Hosts {
+			if ok, _ := path.Match(strings.ToLower(h), host); ok {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if rt.url != nil && !rt.url.MatchString(r.Page) {
+		return false
+	}
+	if len(rt.Validation) > 0 {
+		v := r.Validation()
+		found := false
+		for _, rv := range rt.Validation {
+			if rv == v {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// RouterSink dispatches every entity found to the sinks of the routes it
+// matches. JSON-LD graphs and microdata documents are split so each of
+// their entities is routed on its own, the RDF of a page is routed as a
+// whole, by the types of any of its entities.
+type RouterSink struct {
+	Sinks  map[string]Sink
+	Routes []Route
+
+	open map[string]bool
+}
+
+// routesConfig is the routing configuration file: the sinks by name,
+// given as -sink specifications, and the routes.
+type routesConfig struct {
+	Sinks  map[string]string `json:"sinks"`
+	Routes []Route           `json:"routes"`
+}
+
+// LoadRoutes creates a router from a JSON configuration file. Its sinks
+// cannot write to the standard output. E.g.
+//
+//	{
+//	  "sinks": {"catalogue": "elastic:index=catalogue", "archive": "jsonl:file=archive.jsonl"},
+//	  "routes": [
+//	    {"type": ["Dataset", "DataCatalog"], "sinks": ["catalogue"]},
+//	    {"sinks": ["archive"]}
+//	  ]
+//	}
+func LoadRoutes(fileName string, cw *Crawler) (*RouterSink, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var conf routesConfig
+	if err := json.Unmarshal(b, &conf); err != nil {
+		return nil, fmt.Errorf("invalid routes file %s: %v", fileName, err)
+	}
+
+	sinks := make(map[string]Sink, len(conf.Sinks))
+	for name, spec := range conf.Sinks {
+		sn, params, err := ParseSinkSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		// the log would go to stdout along with the records, it is only
+		// sent to stderr for the -sink flags
+		if params["file"] == Stdout {
+			return nil, fmt.Errorf("sink %s: routed sinks cannot write to the standard output", name)
+		}
+		s, err := NewSink(sn, cw, params)
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: %v", name, err)
+		}
+		sinks[name] = s
+	}
+	return NewRouterSink(sinks, conf.Routes)
+}
+
+// NewRouterSink creates a router dispatching to the named sinks. Every
+// route must use known sinks and a valid URL expression.
+func NewRouterSink(sinks map[string]Sink, routes []Route) (*RouterSink, error) {
+	for i := range routes {
+		rt := &routes[i]
+		if len(rt.Sinks) == 0 {
+			return nil, fmt.Errorf("route %d has no sinks", i+1)
+		}
+		for _, name := range rt.Sinks {
+			if _, ok := sinks[name]; !ok {
+				return nil, fmt.Errorf("route %d uses the unknown sink %q", i+1, name)
+			}
+		}
+		for _, v := range rt.Validation {
+			if v != Valid && v != Repaired && v != Invalid {
+				return nil, fmt.Errorf("route %d: unknown validation %q, use %s, %s or %s", i+1, v, Valid, Repaired, Invalid)
+			}
+		}
+		if rt.URL != "" {
+			re, err := regexp.Compile(rt.URL)
+			if err != nil {
+				return nil, fmt.Errorf("route %d: %v", i+1, err)
+			}
+			rt.url = re
+		}
+	}
+	return &RouterSink{Sinks: sinks, Routes: routes}, nil
+}
+
+// names returns the sink names sorted, for a stable order of operations.
+func (s *RouterSink) names() []string {
+	names := make([]string, 0, len(s.Sinks))
+	for name := range s.Sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens every named sink. When one fails the ones already open are
+// closed.
+func (s *RouterSink) Open() error {
+	s.open = make(map[string]bool)
+	for _, name := range s.names() {
+		if err := s.Sinks[name].Open(); err != nil {
+			if cerr := s.Close(); cerr != nil {
+				log.Error("Error closing routed sinks ", cerr)
+			}
+			s.open = nil
+			return fmt.Errorf("sink %s: %v", name, err)
+		}
+		s.open[name] = true
+	}
+	return nil
+}
+
+// Write routes every entity of the record.
+func (s *RouterSink) Write(r Record) error {
+	var errs []string
+	for _, part := range r.split() {
+		host := ""
+		if u, err := url.Parse(part.Page); err == nil {
+			host = strings.ToLower(u.Host)
+		}
+
+		targets := make(map[string]bool)
+		for i := range s.Routes {
+			rt := &s.Routes[i]
+			if !rt.matches(part, host) {
+				continue
+			}
+			for _, name := range rt.Sinks {
+				targets[name] = true
+			}
+			if !rt.Continue {
+				break
+			}
+		}
+		if len(targets) == 0 {
+			log.Debug("No route for a record of ", part.Page)
+		}
+
+		for _, name := range s.names() {
+			if !targets[name] || !s.open[name] {
+				continue
+			}
+			if err := s.Sinks[name].Write(part); err != nil {
+				errs = append(errs, name+": "+err.Error())
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// PageDone tells the named sinks that are page sinks that a page is done.
+func (s *RouterSink) PageDone(page Record) error {
+	return s.each(func(sk Sink) error {
+		if ps, ok := sk.(PageSink); ok {
+			return ps.PageDone(page)
+		}
+		return nil
+	})
+}
+
+// Flush flushes every named sink.
+func (s *RouterSink) Flush() error {
+	return s.each(Sink.Flush)
+}
+
+// Close closes every named sink.
+func (s *RouterSink) Close() error {
+	return s.each(Sink.Close)
+}
+
+func (s *RouterSink) each(f func(Sink) error) error {
+	var errs []string
+	for _, name := range s.names() {
+		if !s.open[name] {
+			continue
+		}
+		if err := f(s.Sinks[name]); err != nil {
+			errs = append(errs, name+": "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// split returns a record per entity of a JSON-LD graph or microdata
+// document, which keep the context of the graph and are numbered by
+// their Part. Other records are returned as they are.
+func (r Record) split() []Record {
+	if r.Metadata["diagnostic"] != nil {
+		return []Record{r}
+	}
+
+	var parts []map[string]interface{}
+	switch r.Extractor {
+	case ExtractorJSONLD:
+		graph, ok := r.Metadata["@graph"].([]interface{})
+		if !ok || len(graph) < 2 {
+			return []Record{r}
+		}
+		for _, n := range graph {
+			node, ok := n.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			md := make(map[string]interface{}, len(node)+1)
+			for k, v := range node {
+				md[k] = v
+			}
+			if ctx, ok := r.Metadata["@context"]; ok {
+				if _, own := md["@context"]; !own {
+					md["@context"] = ctx
+				}
+			}
+			parts = append(parts, md)
+		}
+
+	case ExtractorMicrodata:
+		items, ok := r.Metadata["items"].([]interface{})
+		if !ok || len(items) < 2 {
+			return []Record{r}
+		}
+		for _, item := range items {
+			parts = append(parts, map[string]interface{}{"items": []interface{}{item}})
+		}
+
+	default:
+		return []Record{r}
+	}
+
+	records := make([]Record, len(parts))
+	for i, md := range parts {
+		records[i] = r
+		records[i].Metadata = md
+		records[i].Part = i + 1
+	}
+	return records
+}
@@ -0,0 +1,122 @@
+package crawler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestRouterSink(t *testing.T) {
+	catalogue, training, archive := &memorySink{}, &memorySink{}, &memorySink{}
+	r, err := NewRouterSink(map[string]Sink{"catalogue": catalogue, "training": training, "archive": archive}, []Route{
+		{Types: []string{"Dataset"}, Hosts: []string{"*.example.com"}, Sinks: []string{"catalogue"}, Continue: true},
+		{Types: []string{"http://schema.org/Event"}, URL: `/events/`, Validation: []string{Valid, Repaired}, Sinks: []string{"training"}},
+		{Validation: []string{Invalid}, Sinks: []string{"catalogue"}},
+		{Sinks: []string{"archive"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	var graph map[string]interface{}
+	json.Unmarshal([]byte(`{"@context":"http://schema.org","@graph":[{"@type":"Dataset","name":"Genes"},{"@type":"Organization","name":"EBI"}]}`), &graph)
+	r.Write(Record{Page: "http://data.example.com/1", Extractor: ExtractorJSONLD, Metadata: graph})
+	r.Write(Record{Page: "http://example.com/events/1", Extractor: ExtractorJSONLD, Repairs: []string{"trailing comma"}, Metadata: map[string]interface{}{"@type": "Event"}})
+	r.Write(Record{Page: "http://example.com/about", Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"@type": "Event"}})
+	r.Write(Record{Page: "http://example.com/broken", Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"diagnostic": "error"}})
+	r.Flush()
+	r.Close()
+
+	if len(catalogue.records) != 2 || catalogue.records[0].Metadata["name"] != "Genes" || catalogue.records[0].Metadata["@context"] != "http://schema.org" {
+		t.Errorf("Unexpected catalogue records %v", catalogue.records)
+	}
+	if catalogue.records[1].Validation() != Invalid {
+		t.Errorf("Expecting the diagnostic on the catalogue, got %v", catalogue.records[1])
+	}
+	if len(training.records) != 1 || training.records[0].Page != "http://example.com/events/1" {
+		t.Errorf("Unexpected training records %v", training.records)
+	}
+	// the Dataset goes on to the archive, the Organization and the Event
+	// out of the events path only match the last route
+	if len(archive.records) != 3 {
+		t.Errorf("Expecting 3 archived records but got %v", archive.records)
+	}
+	if !archive.closed || !catalogue.closed {
+		t.Errorf("Expecting the routed sinks to be closed")
+	}
+}
+
+func TestRouterSinkParts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "route")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := &memorySink{}
+	r, err := NewRouterSink(map[string]Sink{"memory": m, "parquet": NewParquetSink(filepath.Join(dir, "out.parquet"), "")}, []Route{
+		{Sinks: []string{"memory", "parquet"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Open(); err != nil {
+		t.Fatal(err)
+	}
+	var graph map[string]interface{}
+	json.Unmarshal([]byte(`{"@context":"http://schema.org","@graph":[{"@type":"Dataset","name":"Genes"},{"@type":"Dataset","name":"Proteins"}]}`), &graph)
+	if err := r.Write(Record{CrawlID: "c1", Page: "http://example.com/1", Extractor: ExtractorJSONLD, Block: 1, Metadata: graph}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.records) != 2 || m.records[0].Part != 1 || m.records[1].Part != 2 {
+		t.Errorf("Expecting the parts of the graph numbered but got %v", m.records)
+	}
+	entities, err := parquet.ReadFile[parquetEntity](filepath.Join(dir, "out.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entities) != 2 || entities[0].Entity == entities[1].Entity {
+		t.Errorf("Expecting 2 entities with their own keys but got %+v", entities)
+	}
+}
+
+func TestLoadRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := filepath.Join(dir, "routes.json")
+	ioutil.WriteFile(conf, []byte(`{"sinks":{"archive":"jsonl:file=`+filepath.Join(dir, "archive.jsonl")+`"},"routes":[{"sinks":["archive"]}]}`), 0644)
+	r, err := LoadRoutes(conf, &Crawler{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Sinks["archive"].(*JSONLSink); !ok {
+		t.Errorf("Expecting a jsonl sink, got %T", r.Sinks["archive"])
+	}
+
+	for _, routes := range []string{
+		`{"routes":[{"sinks":["nope"]}]}`,
+		`{"sinks":{"a":"jsonl"},"routes":[{"url":"(","sinks":["a"]}]}`,
+		`{"sinks":{"a":"jsonl"},"routes":[{"validation":["maybe"],"sinks":["a"]}]}`,
+		`{"sinks":{"a":"jsonl:file=-"},"routes":[{"sinks":["a"]}]}`,
+	} {
+		ioutil.WriteFile(conf, []byte(routes), 0644)
+		if _, err := LoadRoutes(conf, &Crawler{}); err == nil {
+			t.Errorf("Expecting an error for %s", routes)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package crawler
+
+// schemaParents are the direct supertypes of the schema.org types, and of
+// the Bioschemas types not yet in schema.org, as of schema.org 26. Types
+// missing here are only a subclass of themselves.
+var schemaParents = map[string][]string{
+	"Thing": nil,
+
+	// Actions
+	"Action":         {"Thing"},
+	"SearchAction":   {"Action"},
+	"ConsumeAction":  {"Action"},
+	"ReadAction":     {"ConsumeAction"},
+	"ViewAction":     {"ConsumeAction"},
+	"WatchAction":    {"ConsumeAction"},
+	"DownloadAction": {"TransferAction"},
+	"TransferAction": {"Action"},
+	"CreateAction":   {"Action"},
+	"UpdateAction":   {"Action"},
+	"InteractAction": {"Action"},
+	"OrganizeAction": {"Action"},
+	"PlayAction":     {"Action"},
+
+	// Creative works
+	"CreativeWork":                      {"Thing"},
+	"Article":                           {"CreativeWork"},
+	"NewsArticle":                       {"Article"},
+	"Report":                            {"Article"},
+	"ScholarlyArticle":                  {"Article"},
+	"MedicalScholarlyArticle":           {"ScholarlyArticle"},
+	"TechArticle":                       {"Article"},
+	"APIReference":                      {"TechArticle"},
+	"BlogPosting":                       {"SocialMediaPosting"},
+	"SocialMediaPosting":                {"Article"},
+	"Blog":                              {"CreativeWork"},
+	"Book":                              {"CreativeWork"},
+	"Chapter":                           {"CreativeWork"},
+	"Claim":                             {"CreativeWork"},
+	"Clip":                              {"CreativeWork"},
+	"Code":                              {"CreativeWork"},
+	"Collection":                        {"CreativeWork"},
+	"Comment":                           {"CreativeWork"},
+	"Answer":                            {"Comment"},
+	"Course":                            {"CreativeWork", "LearningResource"},
+	"CreativeWorkSeries":                {"CreativeWork", "Series"},
+	"Periodical":                        {"CreativeWorkSeries"},
+	"DataCatalog":                       {"CreativeWork"},
+	"Dataset":                           {"CreativeWork"},
+	"DataFeed":                          {"Dataset"},
+	"DefinedTermSet":                    {"CreativeWork"},
+	"CategoryCodeSet":                   {"DefinedTermSet"},
+	"DigitalDocument":                   {"CreativeWork"},
+	"Drawing":                           {"CreativeWork"},
+	"EducationalOccupationalCredential": {"CreativeWork"},
+	"Guide":                             {"CreativeWork"},
+	"HowTo":                             {"CreativeWork"},
+	"Recipe":                            {"HowTo"},
+	"HowToDirection":                    {"CreativeWork", "ListItem"},
+	"HowToSection":                      {"CreativeWork", "ItemList", "ListItem"},
+	"HowToStep":                         {"CreativeWork", "ItemList", "ListItem"},
+	"HowToTip":                          {"CreativeWork", "ListItem"},
+	"LearningResource":                  {"CreativeWork"},
+	"Quiz":                              {"LearningResource"},
+	"Syllabus":                          {"LearningResource"},
+	"Legislation":                       {"CreativeWork"},
+	"Map":                               {"CreativeWork"},
+	"MediaObject":                       {"CreativeWork"},
+	"AudioObject":                       {"MediaObject"},
+	"DataDownload":                      {"MediaObject"},
+	"ImageObject":                       {"MediaObject"},
+	"Barcode":                           {"ImageObject"},
+	"MusicVideoObject":                  {"MediaObject"},
+	"TextObject":                        {"MediaObject"},
+	"VideoObject":                       {"MediaObject"},
+	"Message":                           {"CreativeWork"},
+	"EmailMessage":                      {"Message"},
+	"Movie":                             {"CreativeWork"},
+	"MusicComposition":                  {"CreativeWork"},
+	"MusicPlaylist":                     {"CreativeWork"},
+	"MusicRecording":                    {"CreativeWork"},
+	"Painting":                          {"CreativeWork"},
+	"Photograph":                        {"CreativeWork"},
+	"Poster":                            {"CreativeWork"},
+	"PublicationIssue":                  {"CreativeWork"},
+	"PublicationVolume":                 {"CreativeWork"},
+	"Question":                          {"Comment"},
+	"Review":                            {"CreativeWork"},
+	"Sculpture":                         {"CreativeWork"},
+	"Season":                            {"CreativeWork"},
+	"SoftwareApplication":               {"CreativeWork"},
+	"MobileApplication":                 {"SoftwareApplication"},
+	"WebApplication":                    {"SoftwareApplication"},
+	"SoftwareSourceCode":                {"CreativeWork"},
+	"ComputationalWorkflow":             {"SoftwareSourceCode"},
+	"Thesis":                            {"CreativeWork"},
+	"WebContent":                        {"CreativeWork"},
+	"HealthTopicContent":                {"WebContent"},
+	"WebPage":                           {"CreativeWork"},
+	"AboutPage":                         {"WebPage"},
+	"CheckoutPage":                      {"WebPage"},
+	"CollectionPage":                    {"WebPage"},
+	"ImageGallery":                      {"MediaGallery"},
+	"MediaGallery":                      {"CollectionPage"},
+	"VideoGallery":                      {"MediaGallery"},
+	"ContactPage":                       {"WebPage"},
+	"FAQPage":                           {"WebPage"},
+	"ItemPage":                          {"WebPage"},
+	"MedicalWebPage":                    {"WebPage"},
+	"ProfilePage":                       {"WebPage"},
+	"QAPage":                            {"WebPage"},
+	"SearchResultsPage":                 {"WebPage"},
+	"WebPageElement":                    {"CreativeWork"},
+	"SiteNavigationElement":             {"WebPageElement"},
+	"WPFooter":                          {"WebPageElement"},
+	"WPHeader":                          {"WebPageElement"},
+	"WPSideBar":                         {"WebPageElement"},
+	"Table":                             {"WebPageElement"},
+	"WebSite":                           {"CreativeWork"},
+	"LabProtocol":                       {"CreativeWork"},
+
+	// Events
+	"Event":            {"Thing"},
+	"BusinessEvent":    {"Event"},
+	"ChildrensEvent":   {"Event"},
+	"ComedyEvent":      {"Event"},
+	"CourseInstance":   {"Event"},
+	"DanceEvent":       {"Event"},
+	"DeliveryEvent":    {"Event"},
+	"EducationEvent":   {"Event"},
+	"EventSeries":      {"Event", "Series"},
+	"ExhibitionEvent":  {"Event"},
+	"Festival":         {"Event"},
+	"FoodEvent":        {"Event"},
+	"Hackathon":        {"Event"},
+	"LiteraryEvent":    {"Event"},
+	"MusicEvent":       {"Event"},
+	"PublicationEvent": {"Event"},
+	"BroadcastEvent":   {"PublicationEvent"},
+	"SaleEvent":        {"Event"},
+	"ScreeningEvent":   {"Event"},
+	"SocialEvent":      {"Event"},
+	"SportsEvent":      {"Event"},
+	"TheaterEvent":     {"Event"},
+	"VisualArtsEvent":  {"Event"},
+
+	// Intangibles
+	"Intangible":                   {"Thing"},
+	"AlignmentObject":              {"Intangible"},
+	"Audience":                     {"Intangible"},
+	"EducationalAudience":          {"Audience"},
+	"PeopleAudience":               {"Audience"},
+	"Brand":                        {"Intangible"},
+	"BroadcastChannel":             {"Intangible"},
+	"ComputerLanguage":             {"Intangible"},
+	"DataFeedItem":                 {"Intangible"},
+	"DefinedTerm":                  {"Intangible"},
+	"CategoryCode":                 {"DefinedTerm"},
+	"Demand":                       {"Intangible"},
+	"EntryPoint":                   {"Intangible"},
+	"Enumeration":                  {"Intangible"},
+	"Grant":                        {"Intangible"},
+	"MonetaryGrant":                {"Grant"},
+	"ItemList":                     {"Intangible"},
+	"BreadcrumbList":               {"ItemList"},
+	"OfferCatalog":                 {"ItemList"},
+	"JobPosting":                   {"Intangible"},
+	"Language":                     {"Intangible"},
+	"ListItem":                     {"Intangible"},
+	"Offer":                        {"Intangible"},
+	"AggregateOffer":               {"Offer"},
+	"Occupation":                   {"Intangible"},
+	"Order":                        {"Intangible"},
+	"Permit":                       {"Intangible"},
+	"ProgramMembership":            {"Intangible"},
+	"PropertyValueSpecification":   {"Intangible"},
+	"Quantity":                     {"Intangible"},
+	"Duration":                     {"Quantity"},
+	"Distance":                     {"Quantity"},
+	"Mass":                         {"Quantity"},
+	"Rating":                       {"Intangible"},
+	"AggregateRating":              {"Rating"},
+	"Reservation":                  {"Intangible"},
+	"Role":                         {"Intangible"},
+	"OrganizationRole":             {"Role"},
+	"EmployeeRole":                 {"OrganizationRole"},
+	"PerformanceRole":              {"Role"},
+	"Schedule":                     {"Intangible"},
+	"Series":                       {"Intangible"},
+	"Service":                      {"Intangible"},
+	"BroadcastService":             {"Service"},
+	"WebAPI":                       {"Service"},
+	"SpeakableSpecification":       {"Intangible"},
+	"StructuredValue":              {"Intangible"},
+	"ContactPoint":                 {"StructuredValue"},
+	"PostalAddress":                {"ContactPoint"},
+	"GeoCoordinates":               {"StructuredValue"},
+	"GeoShape":                     {"StructuredValue"},
+	"GeoCircle":                    {"GeoShape"},
+	"InteractionCounter":           {"StructuredValue"},
+	"MonetaryAmount":               {"StructuredValue"},
+	"OpeningHoursSpecification":    {"StructuredValue"},
+	"PriceSpecification":           {"StructuredValue"},
+	"PropertyValue":                {"StructuredValue"},
+	"LocationFeatureSpecification": {"PropertyValue"},
+	"QuantitativeValue":            {"StructuredValue"},
+	"TypeAndQuantityNode":          {"StructuredValue"},
+	"Ticket":                       {"Intangible"},
+	"Trip":                         {"Intangible"},
+	"VirtualLocation":              {"Intangible"},
+	"FormalParameter":              {"Intangible"},
+
+	// Medical entities
+	"MedicalEntity":             {"Thing"},
+	"AnatomicalStructure":       {"MedicalEntity"},
+	"AnatomicalSystem":          {"MedicalEntity"},
+	"DrugClass":                 {"MedicalEntity"},
+	"DrugCost":                  {"MedicalEntity"},
+	"MedicalCause":              {"MedicalEntity"},
+	"MedicalCondition":          {"MedicalEntity"},
+	"InfectiousDisease":         {"MedicalCondition"},
+	"MedicalSignOrSymptom":      {"MedicalCondition"},
+	"MedicalSign":               {"MedicalSignOrSymptom"},
+	"MedicalSymptom":            {"MedicalSignOrSymptom"},
+	"MedicalDevice":             {"MedicalEntity"},
+	"MedicalGuideline":          {"MedicalEntity"},
+	"MedicalProcedure":          {"MedicalEntity"},
+	"MedicalStudy":              {"MedicalEntity"},
+	"MedicalTrial":              {"MedicalStudy"},
+	"MedicalObservationalStudy": {"MedicalStudy"},
+	"MedicalTest":               {"MedicalEntity"},
+	"Substance":                 {"MedicalEntity"},
+	"Drug":                      {"Substance"},
+	"DietarySupplement":         {"Substance"},
+	"SuperficialAnatomy":        {"MedicalEntity"},
+	"LifestyleModification":     {"MedicalEntity"},
+	"PhysicalActivity":          {"LifestyleModification"},
+
+	// Organizations
+	"Organization":             {"Thing"},
+	"Airline":                  {"Organization"},
+	"Consortium":               {"Organization"},
+	"Corporation":              {"Organization"},
+	"EducationalOrganization":  {"CivicStructure", "Organization"},
+	"CollegeOrUniversity":      {"EducationalOrganization"},
+	"HighSchool":               {"EducationalOrganization"},
+	"School":                   {"EducationalOrganization"},
+	"FundingScheme":            {"Organization"},
+	"GovernmentOrganization":   {"Organization"},
+	"LibrarySystem":            {"Organization"},
+	"LocalBusiness":            {"Organization", "Place"},
+	"Library":                  {"LocalBusiness"},
+	"MedicalOrganization":      {"Organization"},
+	"Hospital":                 {"CivicStructure", "EmergencyService", "MedicalOrganization"},
+	"EmergencyService":         {"LocalBusiness"},
+	"NGO":                      {"Organization"},
+	"NewsMediaOrganization":    {"Organization"},
+	"OnlineBusiness":           {"Organization"},
+	"PerformingGroup":          {"Organization"},
+	"PoliticalParty":           {"Organization"},
+	"Project":                  {"Organization"},
+	"FundingAgency":            {"Project"},
+	"ResearchProject":          {"Project"},
+	"ResearchOrganization":     {"Organization"},
+	"SearchRescueOrganization": {"Organization"},
+	"SportsOrganization":       {"Organization"},
+	"WorkersUnion":             {"Organization"},
+
+	// People
+	"Person":          {"Thing"},
+	"Patient":         {"MedicalAudience", "Person"},
+	"MedicalAudience": {"Audience", "PeopleAudience"},
+
+	// Places
+	"Place":                          {"Thing"},
+	"Accommodation":                  {"Place"},
+	"AdministrativeArea":             {"Place"},
+	"City":                           {"AdministrativeArea"},
+	"Country":                        {"AdministrativeArea"},
+	"State":                          {"AdministrativeArea"},
+	"CivicStructure":                 {"Place"},
+	"Museum":                         {"CivicStructure"},
+	"Landform":                       {"Place"},
+	"LandmarksOrHistoricalBuildings": {"Place"},
+	"Residence":                      {"Place"},
+	"TouristAttraction":              {"Place"},
+	"TouristDestination":             {"Place"},
+
+	// Products
+	"Product":           {"Thing"},
+	"IndividualProduct": {"Product"},
+	"ProductGroup":      {"Product"},
+	"ProductModel":      {"Product"},
+	"SomeProducts":      {"Product"},
+	"Vehicle":           {"Product"},
+
+	// Taxa and biological and chemical entities, from Bioschemas
+	"Taxon":             {"Thing"},
+	"BioChemEntity":     {"Thing"},
+	"ChemicalSubstance": {"BioChemEntity"},
+	"Gene":              {"BioChemEntity"},
+	"MolecularEntity":   {"BioChemEntity"},
+	"Protein":           {"BioChemEntity"},
+	"Sample":            {"BioChemEntity"},
+}
+
+// IsSubclass tells whether a type is the other one or one of its
+// subclasses, following the schema.org hierarchy. Both can be full
+// schema.org IRIs or short names.
+func IsSubclass(t, of string) bool {
+	t, of = shortType(t), shortType(of)
+	seen := make(map[string]bool)
+	var walk func(string) bool
+	walk = func(t string) bool {
+		if t == of {
+			return true
+		}
+		if seen[t] {
+			return false
+		}
+		seen[t] = true
+		for _, p := range schemaParents[t] {
+			if walk(p) {
+				return true
+			}
+		}
+		return false
+	}
+	return walk(t)
+}
@@ -0,0 +1,109 @@
+package crawler
+
+import (
+	"encoding/json"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// SearchQuery selects entities of the local search index. Every given
+// criterion must match: Text is searched on every field, Types holds
+// the accepted types and Properties the property path and phrase pairs,
+// e.g. creator.name: Jane.
+type SearchQuery struct {
+	Text       string
+	Types      []string
+	Properties map[string]string
+	Size       int
+}
+
+// SearchResult is an entity found on the search index.
+type SearchResult struct {
+	Score   float64                `json:"score"`
+	Types   []string               `json:"type"`
+	ID      string                 `json:"id,omitempty"`
+	Page    string                 `json:"page"`
+	Pages   []string               `json:"pages,omitempty"`
+	Source  string                 `json:"source,omitempty"`
+	CrawlID string                 `json:"crawl_id,omitempty"`
+	Data    map[string]interface{} `json:"data"`
+}
+
+// Search queries the local search index built by the bleve sink.
+func Search(path string, q SearchQuery) ([]SearchResult, uint64, error) {
+	index, err := bleve.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer index.Close()
+
+	var conjuncts []query.Query
+	if q.Text != "" {
+		conjuncts = append(conjuncts, bleve.NewMatchQuery(q.Text))
+	}
+	if len(q.Types) > 0 {
+		var types []query.Query
+		for _, t := range q.Types {
+			tq := bleve.NewTermQuery(shortType(t))
+			tq.SetField("type")
+			types = append(types, tq)
+		}
+		conjuncts = append(conjuncts, bleve.NewDisjunctionQuery(types...))
+	}
+	for p, v := range q.Properties {
+		pq := bleve.NewMatchPhraseQuery(v)
+		pq.SetField("properties." + p)
+		conjuncts = append(conjuncts, pq)
+	}
+
+	var bq query.Query = bleve.NewMatchAllQuery()
+	if len(conjuncts) > 0 {
+		bq = bleve.NewConjunctionQuery(conjuncts...)
+	}
+
+	size := q.Size
+	if size <= 0 {
+		size = 10
+	}
+	req := bleve.NewSearchRequestOptions(bq, size, 0, false)
+	req.Fields = []string{"type", "entity_id", "page", "pages", "source", "crawl_id", "raw"}
+
+	res, err := index.Search(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var results []SearchResult
+	for _, hit := range res.Hits {
+		r := SearchResult{
+			Score:   hit.Score,
+			Types:   fieldStrings(hit.Fields["type"]),
+			ID:      fieldString(hit.Fields["entity_id"]),
+			Page:    fieldString(hit.Fields["page"]),
+			Pages:   fieldStrings(hit.Fields["pages"]),
+			Source:  fieldString(hit.Fields["source"]),
+			CrawlID: fieldString(hit.Fields["crawl_id"]),
+		}
+		if raw := fieldString(hit.Fields["raw"]); raw != "" {
+			json.Unmarshal([]byte(raw), &r.Data)
+		}
+		results = append(results, r)
+	}
+	return results, res.Total, nil
+}
+
+func fieldString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func fieldStrings(v interface{}) []string {
+	var res []string
+	for _, i := range asList(v) {
+		if s, ok := i.(string); ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
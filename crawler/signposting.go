@@ -0,0 +1,164 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gocolly/colly"
+	log "github.com/sirupsen/logrus"
+)
+
+// signpostingRels are the FAIR Signposting relation types recorded
+// from Link headers and link elements. See https://signposting.org/FAIR/
+var signpostingRels = map[string]bool{
+	"author":      true,
+	"cite-as":     true,
+	"collection":  true,
+	"describedby": true,
+	"describes":   true,
+	"item":        true,
+	"license":     true,
+	"linkset":     true,
+	"type":        true,
+}
+
+// SignpostingLink is a typed link announced by a page.
+type SignpostingLink struct {
+	Rel     string `json:"rel"`
+	Href    string `json:"href"`
+	Type    string `json:"type,omitempty"`
+	Profile string `json:"profile,omitempty"`
+}
+
+// parseLinkHeader parses the value of an HTTP Link header as defined in
+// RFC 8288 and returns the signposting links it holds. A link with
+// several relation types is returned once per relation.
+func parseLinkHeader(h string, base *url.URL) []SignpostingLink {
+	var links []SignpostingLink
+
+	for _, lv := range splitLinkValues(h) {
+		lv = strings.TrimSpace(lv)
+		if !strings.HasPrefix(lv, "<") {
+			continue
+		}
+		end := strings.Index(lv, ">")
+		if end < 0 {
+			continue
+		}
+		href := lv[1:end]
+		params := make(map[string]string)
+		for _, p := range splitQuoted(lv[end+1:], ';') {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			k := strings.ToLower(strings.TrimSpace(kv[0]))
+			if _, dup := params[k]; !dup {
+				params[k] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			}
+		}
+		links = append(links, signpostingLinks(params["rel"], href, params["type"], params["profile"], base)...)
+	}
+	return links
+}
+
+// signpostingLinks creates the links of the signposting relations in
+// a space separated rel value.
+func signpostingLinks(rel, href, typ, profile string, base *url.URL) []SignpostingLink {
+	var links []SignpostingLink
+
+	if u, err := base.Parse(strings.TrimSpace(href)); err == nil {
+		href = u.String()
+	}
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		if signpostingRels[r] {
+			links = append(links, SignpostingLink{Rel: r, Href: href, Type: typ, Profile: profile})
+		}
+	}
+	return links
+}
+
+// splitLinkValues splits a Link header on the commas separating link values.
+func splitLinkValues(h string) []string {
+	var values []string
+	inURI, inQuote := false, false
+	start := 0
+	for i, c := range h {
+		switch {
+		case c == '<' && !inQuote:
+			inURI = true
+		case c == '>' && !inQuote:
+			inURI = false
+		case c == '"' && !inURI:
+			inQuote = !inQuote
+		case c == ',' && !inURI && !inQuote:
+			values = append(values, h[start:i])
+			start = i + 1
+		}
+	}
+	return append(values, h[start:])
+}
+
+// splitQuoted splits s on sep when it is not inside a quoted string.
+func splitQuoted(s string, sep rune) []string {
+	var parts []string
+	inQuote := false
+	start := 0
+	for i, c := range s {
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+		case c == sep && !inQuote:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// addSignposting stores links found for a response on its context,
+// they are emitted once the response has been scraped.
+func addSignposting(ctx *colly.Context, links []SignpostingLink) {
+	if len(links) == 0 {
+		return
+	}
+	current, _ := ctx.GetAny("signposting").([]SignpostingLink)
+	for _, l := range links {
+		dup := false
+		for _, c := range current {
+			if c == l {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			current = append(current, l)
+		}
+	}
+	ctx.Put("signposting", current)
+}
+
+// emitSignposting records the signposting links of a page and follows
+// its describedby links, regardless of the crawl depth and filters.
+func (cw *Crawler) emitSignposting(r *colly.Response) {
+	links, _ := r.Ctx.GetAny("signposting").([]SignpostingLink)
+	if len(links) == 0 {
+		return
+	}
+	page := r.Request.URL.String()
+
+	log.WithFields(log.Fields{
+		"URL":   page,
+		"Links": len(links),
+	}).Info("Signposting links found")
+
+	cw.emit(Record{Page: page, Extractor: ExtractorSignposting, Metadata: map[string]interface{}{
+		"signposting": links,
+	}})
+
+	for _, l := range links {
+		if l.Rel == "describedby" {
+			cw.followMetadata(page, l.Href, l.Type)
+		}
+	}
+}
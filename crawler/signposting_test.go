@@ -0,0 +1,45 @@
+package crawler
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	base, _ := url.Parse("https://example.com/record/1")
+	h := `<https://doi.org/10.5281/zenodo.1>; rel="cite-as", </record/1/export/json-ld>; rel="describedby"; type="application/ld+json"; profile="https://schema.org", <https://schema.org/Dataset>; rel="type", <https://schema.org/AboutPage>; rel="type alternate", <https://example.com/style.css>; rel="stylesheet"`
+
+	links := parseLinkHeader(h, base)
+
+	if len(links) != 4 {
+		t.Fatalf("Expecting 4 links but got %d: %v", len(links), links)
+	}
+
+	if links[0].Rel != "cite-as" || links[0].Href != "https://doi.org/10.5281/zenodo.1" {
+		t.Errorf("Unexpected cite-as link %v", links[0])
+	}
+
+	d := links[1]
+	if d.Rel != "describedby" || d.Href != "https://example.com/record/1/export/json-ld" {
+		t.Errorf("Unexpected describedby link %v", d)
+	}
+	if d.Type != "application/ld+json" || d.Profile != "https://schema.org" {
+		t.Errorf("Expecting type and profile on describedby link but got %v", d)
+	}
+
+	if links[3].Rel != "type" || links[3].Href != "https://schema.org/AboutPage" {
+		t.Errorf("Unexpected type link %v", links[3])
+	}
+}
+
+func TestParseLinkHeaderQuotedComma(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	links := parseLinkHeader(`<https://example.com/a,b>; rel="item"; type="text/csv; header=present"`, base)
+
+	if len(links) != 1 {
+		t.Fatalf("Expecting 1 link but got %d: %v", len(links), links)
+	}
+	if links[0].Href != "https://example.com/a,b" || links[0].Type != "text/csv; header=present" {
+		t.Errorf("Unexpected item link %v", links[0])
+	}
+}
@@ -0,0 +1,390 @@
+package crawler
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly"
+	log "github.com/sirupsen/logrus"
+)
+
+// Extractors a record can come from.
+const (
+	ExtractorJSONLD      = "json-ld"
+	ExtractorMicrodata   = "microdata"
+	ExtractorRDFa        = "rdfa"
+	ExtractorRDF         = "rdf"
+	ExtractorSignposting = "signposting"
+)
+
+// Record is the metadata extracted from a page, as handed to the sinks.
+// Page is the URL the crawler requested and FinalURL the one it got
+// after redirects. Status, FetchedAt and Hash describe the response of
+// the page, Hash being the SHA-1 of its body. Block is the position of
+// the script block the metadata comes from on the page, and Part the
+// position, from 1, of the entity a routed record was split to within
+// its block. Pages lists the pages a deduplicated entity was found on.
+type Record struct {
+	CrawlID   string                 `json:"crawl_id,omitempty"`
+	Page      string                 `json:"page"`
+	FinalURL  string                 `json:"final_url,omitempty"`
+	Source    string                 `json:"source,omitempty"`
+	Extractor string                 `json:"extractor,omitempty"`
+	Block     int                    `json:"block"`
+	Part      int                    `json:"part,omitempty"`
+	Status    int                    `json:"status,omitempty"`
+	FetchedAt time.Time              `json:"fetched_at"`
+	Hash      string                 `json:"hash,omitempty"`
+	Repairs   []string               `json:"repairs,omitempty"`
+	Pages     []string               `json:"pages,omitempty"`
+	Metadata  map[string]interface{} `json:"data"`
+}
+
+// EnvelopeVersion is the version of the output envelope. It changes
+// when fields are renamed or removed, not when new ones are added.
+const EnvelopeVersion = 1
+
+// Envelope is a record as written to the outputs: the crawl and fetch
+// provenance of the metadata next to the metadata itself, untouched.
+type Envelope struct {
+	Version     int                    `json:"version"`
+	CrawlID     string                 `json:"crawl_id,omitempty"`
+	Page        string                 `json:"page"`
+	FinalURL    string                 `json:"final_url,omitempty"`
+	Status      int                    `json:"status,omitempty"`
+	FetchedAt   *time.Time             `json:"fetched_at,omitempty"`
+	ContentHash string                 `json:"content_hash,omitempty"`
+	Extractor   string                 `json:"extractor,omitempty"`
+	Block       int                    `json:"block"`
+	Part        int                    `json:"part,omitempty"`
+	Source      string                 `json:"source,omitempty"`
+	Repairs     []string               `json:"repairs,omitempty"`
+	Pages       []string               `json:"pages,omitempty"`
+	Data        map[string]interface{} `json:"data"`
+}
+
+// Envelope wraps the record metadata in an output envelope.
+func (r Record) Envelope() Envelope {
+	e := Envelope{
+		Version:     EnvelopeVersion,
+		CrawlID:     r.CrawlID,
+		Page:        r.Page,
+		FinalURL:    r.FinalURL,
+		Status:      r.Status,
+		ContentHash: r.Hash,
+		Extractor:   r.Extractor,
+		Block:       r.Block,
+		Part:        r.Part,
+		Source:      r.Source,
+		Repairs:     r.Repairs,
+		Pages:       r.Pages,
+		Data:        r.Metadata,
+	}
+	if !r.FetchedAt.IsZero() {
+		t := r.FetchedAt
+		e.FetchedAt = &t
+	}
+	if e.Data == nil {
+		e.Data = map[string]interface{}{}
+	}
+	return e
+}
+
+// Record returns the record an envelope was written for. The triples of
+// RDF and RDFa records read back from JSON are decoded into Triples.
+func (e Envelope) Record() Record {
+	r := Record{
+		CrawlID:   e.CrawlID,
+		Page:      e.Page,
+		FinalURL:  e.FinalURL,
+		Source:    e.Source,
+		Extractor: e.Extractor,
+		Block:     e.Block,
+		Part:      e.Part,
+		Status:    e.Status,
+		Hash:      e.ContentHash,
+		Repairs:   e.Repairs,
+		Pages:     e.Pages,
+		Metadata:  e.Data,
+	}
+	if e.FetchedAt != nil {
+		r.FetchedAt = *e.FetchedAt
+	}
+	if raw, ok := r.Metadata["triples"].([]interface{}); ok && (r.Extractor == ExtractorRDF || r.Extractor == ExtractorRDFa) {
+		if ts, err := decodeTriples(raw); err == nil {
+			r.Metadata = copyMap(r.Metadata)
+			r.Metadata["triples"] = ts
+		}
+	}
+	return r
+}
+
+// decodeTriples converts triples decoded from JSON as generic values.
+func decodeTriples(raw []interface{}) ([]Triple, error) {
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var ts []Triple
+	err = json.Unmarshal(b, &ts)
+	return ts, err
+}
+
+// Sink receives the records extracted during a crawl. Open is called
+// before the crawl starts, Write for every record, and Flush followed
+// by Close once the crawl is over.
+type Sink interface {
+	Open() error
+	Write(r Record) error
+	Flush() error
+	Close() error
+}
+
+// PageSink is a sink told when every record of a page has been written
+// to it, once the page has been scraped, pages without metadata
+// included. The records of a page may come after those of the pages it
+// links to, which are crawled first. The page is given as a record with
+// its fetch provenance, as on its records, and no metadata.
+type PageSink interface {
+	Sink
+	PageDone(page Record) error
+}
+
+// SinkFactory creates a sink for a crawler. params holds the sink
+// options given on the command line.
+type SinkFactory func(cw *Crawler, params map[string]string) (Sink, error)
+
+var (
+	sinksMu       sync.RWMutex
+	sinkFactories = make(map[string]SinkFactory)
+	sinkParams    = make(map[string][]string)
+)
+
+// RegisterSink makes a sink available by name to NewSink and to the
+// command line. params are the parameters the sink takes, NewSink
+// rejects any other so a misspelt one is not silently ignored; without
+// them every parameter is passed to the factory. Registering a name
+// twice replaces the previous factory.
+func RegisterSink(name string, f SinkFactory, params ...string) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	sinkFactories[name] = f
+	sinkParams[name] = params
+}
+
+// SinkNames returns the names of the registered sinks.
+func SinkNames() []string {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+
+	var names []string
+	for n := range sinkFactories {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSink creates a registered sink. It fails on the parameters the
+// sink was not registered with.
+func NewSink(name string, cw *Crawler, params map[string]string) (Sink, error) {
+	sinksMu.RLock()
+	f, ok := sinkFactories[name]
+	known := sinkParams[name]
+	sinksMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown sink %q, available sinks: %s", name, strings.Join(SinkNames(), ", "))
+	}
+
+	if len(known) > 0 {
+		var unknown []string
+		for k := range params {
+			found := false
+			for _, kk := range known {
+				if k == kk {
+					found = true
+				}
+			}
+			if !found {
+				unknown = append(unknown, k)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			sorted := append([]string(nil), known...)
+			sort.Strings(sorted)
+			return nil, fmt.Errorf("unknown %s sink parameters %s, available: %s", name, strings.Join(unknown, ", "), strings.Join(sorted, ", "))
+		}
+	}
+	return f(cw, params)
+}
+
+// ParseSinkSpec parses a command line sink specification of the form
+// name or name:key=value,key=value.
+func ParseSinkSpec(spec string) (string, map[string]string, error) {
+	params := make(map[string]string)
+
+	parts := strings.SplitN(spec, ":", 2)
+	name := strings.TrimSpace(parts[0])
+	if name == "" {
+		return "", nil, fmt.Errorf("empty sink name in %q", spec)
+	}
+	if len(parts) == 1 || strings.TrimSpace(parts[1]) == "" {
+		return name, params, nil
+	}
+
+	for _, kv := range strings.Split(parts[1], ",") {
+		p := strings.SplitN(kv, "=", 2)
+		if len(p) != 2 || strings.TrimSpace(p[0]) == "" {
+			return "", nil, fmt.Errorf("invalid sink parameter %q in %q", kv, spec)
+		}
+		params[strings.TrimSpace(p[0])] = strings.TrimSpace(p[1])
+	}
+	return name, params, nil
+}
+
+// SplitList splits a list of a sink parameter or of a flag, whose items
+// are separated by semicolons, as commas separate the sink parameters,
+// or by commas, trimming the spaces around them.
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == ',' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// AddSink adds a sink the extracted records are written to.
+func (cw *Crawler) AddSink(s Sink) {
+	cw.Sinks = append(cw.Sinks, s)
+}
+
+// openSinks opens every sink. When one fails the ones already open are
+// closed, as the crawl would miss an output that was asked for.
+func (cw *Crawler) openSinks() error {
+	for i, s := range cw.Sinks {
+		if err := s.Open(); err != nil {
+			for _, o := range cw.Sinks[:i] {
+				if cerr := o.Close(); cerr != nil {
+					log.Error("Error closing sink ", fmt.Sprintf("%T", o), " ", cerr)
+				}
+			}
+			cw.Sinks = nil
+			return fmt.Errorf("error opening sink %T: %v", s, err)
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes every sink. The records emitted afterwards
+// are dropped, so it can be called to stop on an interrupt while the
+// crawl goes on.
+func (cw *Crawler) Close() {
+	cw.sinksMu.Lock()
+	defer cw.sinksMu.Unlock()
+
+	cw.emitDeduped()
+	for _, s := range cw.Sinks {
+		if err := s.Flush(); err != nil {
+			log.Error("Error flushing sink ", fmt.Sprintf("%T", s), " ", err)
+		}
+		if err := s.Close(); err != nil {
+			log.Error("Error closing sink ", fmt.Sprintf("%T", s), " ", err)
+		}
+	}
+	cw.Sinks = nil
+}
+
+// pageInfo is the response information of a page being scraped. URL
+// is the URL requested, before redirects.
+type pageInfo struct {
+	URL       string
+	Status    int
+	FetchedAt time.Time
+	Hash      string
+}
+
+// requestedURL is the context key of the URL a request was made for.
+const requestedURL = "requestedURL"
+
+// recordPage keeps the response information of a page for its records.
+func (cw *Crawler) recordPage(r *colly.Response) {
+	cw.pages[r.Request.URL.String()] = pageInfo{
+		URL:       r.Ctx.Get(requestedURL),
+		Status:    r.StatusCode,
+		FetchedAt: time.Now().UTC(),
+		Hash:      fmt.Sprintf("%x", sha1.Sum(r.Body)),
+	}
+}
+
+// forgetPage drops the response information of a scraped page.
+func (cw *Crawler) forgetPage(r *colly.Response) {
+	delete(cw.pages, r.Request.URL.String())
+}
+
+// pageDone tells the sinks that every record of a scraped page has been
+// written.
+func (cw *Crawler) pageDone(r *colly.Response) {
+	page := cw.provenance(Record{Page: r.Request.URL.String()})
+	if page.FinalURL == "" {
+		if u := r.Ctx.Get(requestedURL); u != "" {
+			page.Page = u
+		}
+	}
+
+	cw.sinksMu.Lock()
+	defer cw.sinksMu.Unlock()
+	for _, s := range cw.Sinks {
+		if ps, ok := s.(PageSink); ok {
+			if err := ps.PageDone(page); err != nil {
+				log.Error("Error writing the records of ", page.Page, " to sink ", fmt.Sprintf("%T", s), " ", err)
+			}
+		}
+	}
+}
+
+// provenance sets the crawl and the response information of the record
+// page, which is found by the URL it was fetched from and becomes the
+// URL requested.
+func (cw *Crawler) provenance(r Record) Record {
+	r.CrawlID = cw.CrawlID
+	if p, ok := cw.pages[r.Page]; ok {
+		r.Status, r.FetchedAt, r.Hash = p.Status, p.FetchedAt, p.Hash
+		r.FinalURL = r.Page
+		if p.URL != "" {
+			r.Page = p.URL
+		}
+	}
+	return r
+}
+
+// emit sends a record to every sink, once filtered.
+func (cw *Crawler) emit(r Record) {
+	r, ok := cw.filter(r)
+	if !ok {
+		return
+	}
+	r = cw.provenance(r)
+
+	cw.sinksMu.Lock()
+	defer cw.sinksMu.Unlock()
+	if r, ok = cw.dedupe(r); ok {
+		cw.write(r)
+	}
+}
+
+// write sends a record to every sink, sinksMu must be held.
+func (cw *Crawler) write(r Record) {
+	for _, s := range cw.Sinks {
+		if err := s.Write(r); err != nil {
+			log.Error("Error writing record of ", r.Page, " to sink ", fmt.Sprintf("%T", s), " ", err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package crawler
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultSearchIndex is the path of the local search index.
+const DefaultSearchIndex = "bioschemas_gocrawlit.bleve"
+
+func init() {
+	RegisterSink("bleve", func(cw *Crawler, params map[string]string) (Sink, error) {
+		p := params["path"]
+		if p == "" {
+			p = DefaultSearchIndex
+		}
+		return NewBleveSink(p), nil
+	}, "path")
+}
+
+// bleveBatch is the number of entities indexed on each batch.
+const bleveBatch = 500
+
+// BleveSink builds a local full text search index of the entities found,
+// to be queried with Search. Entities are indexed with their types, page,
+// the pages a deduplicated entity was found on, source, extractor, crawl
+// ID and properties, and keep their JSON.
+// Recrawled entities replace their previous version.
+type BleveSink struct {
+	Path string
+
+	index    bleve.Index
+	batch    *bleve.Batch
+	ordinals map[string]int
+}
+
+// NewBleveSink creates a sink indexing on the given path.
+func NewBleveSink(path string) *BleveSink {
+	return &BleveSink{Path: path}
+}
+
+// searchMapping is the mapping of the search index. Properties are
+// indexed as full text under properties.<path>, the other fields are
+// exact values.
+func searchMapping() mapping.IndexMapping {
+	keyword := bleve.NewKeywordFieldMapping()
+
+	raw := bleve.NewTextFieldMapping()
+	raw.Index = false
+	raw.IncludeInAll = false
+
+	dm := bleve.NewDocumentMapping()
+	for _, f := range []string{"type", "entity_id", "page", "pages", "source", "extractor", "crawl_id"} {
+		dm.AddFieldMappingsAt(f, keyword)
+	}
+	dm.AddFieldMappingsAt("raw", raw)
+
+	im := bleve.NewIndexMapping()
+	im.DefaultMapping = dm
+	im.StoreDynamic = false
+	return im
+}
+
+// openSearchIndex opens the search index, creating it if needed.
+func openSearchIndex(path string) (bleve.Index, error) {
+	index, err := bleve.Open(path)
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		log.Info("Creating search index ", path)
+		return bleve.New(path, searchMapping())
+	}
+	return index, err
+}
+
+// Open opens or creates the index.
+func (s *BleveSink) Open() error {
+	index, err := openSearchIndex(s.Path)
+	if err != nil {
+		return err
+	}
+	log.Info("Indexing entities on ", s.Path)
+	s.index = index
+	s.batch = index.NewBatch()
+	s.ordinals = make(map[string]int)
+	return nil
+}
+
+// Write adds the entities of the record to the current batch.
+func (s *BleveSink) Write(r Record) error {
+	for _, e := range r.Entities() {
+		raw, err := json.Marshal(e.Data)
+		if err != nil {
+			return err
+		}
+
+		props := make(map[string]interface{})
+		for _, p := range e.Properties() {
+			if values, ok := props[p.Path].([]string); ok {
+				props[p.Path] = append(values, p.Value)
+			} else {
+				props[p.Path] = []string{p.Value}
+			}
+		}
+
+		doc := map[string]interface{}{
+			"type":       e.Types,
+			"entity_id":  e.ID,
+			"page":       r.Page,
+			"source":     r.Source,
+			"extractor":  r.Extractor,
+			"crawl_id":   r.CrawlID,
+			"raw":        string(raw),
+			"properties": props,
+		}
+		if len(r.Pages) > 0 {
+			doc["pages"] = r.Pages
+		}
+		if err := s.batch.Index(s.entityID(r, e), doc); err != nil {
+			return err
+		}
+	}
+
+	if s.batch.Size() >= bleveBatch {
+		return s.Flush()
+	}
+	return nil
+}
+
+// entityID returns the document ID of an entity: a hash of the page,
+// where it was extracted from and its @id, or its types and position
+// among the entities of the same types of the page when it has none.
+func (s *BleveSink) entityID(r Record, e Entity) string {
+	key := strings.Join([]string{r.Page, r.Extractor, r.Source}, "\n")
+	if e.ID != "" {
+		key += "\nid " + e.ID
+	} else {
+		key += "\n" + strings.Join(e.Types, " ")
+		n := s.ordinals[key]
+		s.ordinals[key]++
+		key += fmt.Sprintf(" #%d", n)
+	}
+	return fmt.Sprintf("%x", sha1.Sum([]byte(key)))
+}
+
+// Flush indexes the current batch.
+func (s *BleveSink) Flush() error {
+	if s.batch.Size() == 0 {
+		return nil
+	}
+	err := s.index.Batch(s.batch)
+	s.batch.Reset()
+	return err
+}
+
+// Close closes the index.
+func (s *BleveSink) Close() error {
+	return s.index.Close()
+}
@@ -0,0 +1,655 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterSink("elastic", func(cw *Crawler, params map[string]string) (Sink, error) {
+		s := NewElasticSink(params["url"], params["index"])
+		if s.Index == "" {
+			s.Index = cw.Index
+		}
+		s.crawler = cw
+		s.Username = params["username"]
+		s.Password = params["password"]
+		s.APIKey = params["apikey"]
+		s.CACert = params["ca"]
+
+		var err error
+		if v := params["insecure"]; v != "" {
+			if s.Insecure, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("invalid elastic insecure value %q", v)
+			}
+		}
+		if v := params["batch"]; v != "" {
+			if s.BatchSize, err = strconv.Atoi(v); err != nil || s.BatchSize < 1 {
+				return nil, fmt.Errorf("invalid elastic batch size %q", v)
+			}
+		}
+		if err := retryParams(&s.Retry, "elastic", params); err != nil {
+			return nil, err
+		}
+		s.DeadLetter = params["deadletter"]
+		s.Alias = params["alias"]
+		if v := params["keep"]; v != "" {
+			if s.Keep, err = strconv.Atoi(v); err != nil || s.Keep < 0 {
+				return nil, fmt.Errorf("invalid elastic keep value %q", v)
+			}
+		}
+		if v := params["stale"]; v != "" {
+			switch v {
+			case StaleKeep, StaleFlag, StaleDelete:
+				s.Stale = v
+			default:
+				return nil, fmt.Errorf("invalid elastic stale value %q, use %s, %s or %s", v, StaleKeep, StaleFlag, StaleDelete)
+			}
+		}
+		return s, nil
+	}, append([]string{"url", "index", "username", "password", "apikey", "ca", "insecure", "batch", "deadletter", "alias", "keep", "stale"}, retryKeys...)...)
+}
+
+// What to do with the documents of previous crawls not found again.
+const (
+	StaleKeep   = "keep"
+	StaleFlag   = "flag"
+	StaleDelete = "delete"
+)
+
+// ElasticSink indexes the records on an Elasticsearch 6, 7 or 8 or an
+// OpenSearch service through the bulk API. Documents are sent in
+// batches by a background worker, Write blocks while the worker is
+// behind so the crawl never gets too far ahead of the service. Bulk
+// requests are retried as set by Retry. Documents the service rejects,
+// and the ones of bulk requests that still fail, are counted and logged,
+// and appended to the DeadLetter bulk file when it is set.
+//
+// Document IDs are derived from the page and the identity of the
+// record, so recrawled records replace their previous version. Every
+// document holds the crawl_id of the crawl that last saw it and the
+// seed URL of that crawl. Once a crawl completes without failures, the
+// documents of the same seed not seen by it are kept, flagged as stale
+// or deleted, as set by Stale.
+type ElasticSink struct {
+	URL string
+	// Index is the index name, it can hold the {host}, {date} and
+	// {crawl} placeholders, e.g. bioschemas-{host}-{date}.
+	Index    string
+	Username string
+	Password string
+	APIKey   string
+	// CACert is a PEM file with the certificate authorities to trust.
+	CACert   string
+	Insecure bool
+
+	// BatchSize is the number of documents sent on each bulk request.
+	BatchSize int
+	Retry
+	Client     *http.Client
+	DeadLetter string
+	Stale      string
+	// Alias is pointed at the index once a crawl completes, it can
+	// use the placeholders of Index.
+	Alias string
+	// Keep is the number of indices of the index name template kept,
+	// the oldest ones are deleted once a crawl completes. 0 keeps all.
+	Keep int
+
+	crawler    *Crawler
+	index      string
+	ordinals   map[string]int
+	docType    string
+	composable bool
+	buf        bytes.Buffer
+	n          int
+	batches    chan elasticBatch
+	pending    sync.WaitGroup
+	done       chan struct{}
+	deadLetter deadLetter
+
+	indexed  int64
+	failed   int64
+	reported int64
+}
+
+type elasticBatch struct {
+	body []byte
+	n    int
+}
+
+// NewElasticSink creates a sink indexing on the given service and index.
+func NewElasticSink(url, index string) *ElasticSink {
+	if url == "" {
+		url = "http://127.0.0.1:9200"
+	}
+	return &ElasticSink{
+		URL:       strings.TrimSuffix(url, "/"),
+		Index:     index,
+		BatchSize: 500,
+		Retry:     DefaultRetry,
+		Stale:     StaleKeep,
+	}
+}
+
+// Open checks the service version, creates the index when it does not
+// exist and starts the bulk worker.
+func (s *ElasticSink) Open() error {
+	if s.Client == nil {
+		c, err := s.newClient()
+		if err != nil {
+			return err
+		}
+		s.Client = c
+	}
+
+	var info struct {
+		Version struct {
+			Number       string `json:"number"`
+			Distribution string `json:"distribution"`
+		} `json:"version"`
+	}
+	if err := s.do("GET", "/", nil, &info); err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"URL":          s.URL,
+		"Version":      info.Version.Number,
+		"Distribution": info.Version.Distribution,
+	}).Info("Connected to search service")
+
+	// Elasticsearch 6 still needs a mapping type on every document,
+	// composable index templates come with Elasticsearch 7.8
+	v := strings.SplitN(info.Version.Number, ".", 3)
+	major, _ := strconv.Atoi(v[0])
+	minor := 0
+	if len(v) > 1 {
+		minor, _ = strconv.Atoi(v[1])
+	}
+	opensearch := info.Version.Distribution == "opensearch"
+	if !opensearch && major > 0 && major < 7 {
+		s.docType = "_doc"
+	}
+	s.composable = opensearch || major > 7 || (major == 7 && minor >= 8)
+
+	s.index = resolveIndexName(s.Index, s.host(), s.crawlID(), time.Now().UTC())
+
+	if err := s.putTemplate(); err != nil {
+		log.Warn("Error installing the index template of ", s.index, " ", err)
+	}
+	if err := s.createIndex(); err != nil {
+		return err
+	}
+	if err := s.putMapping(); err != nil {
+		log.Warn("Error setting the mapping of ", s.index, ", stale documents are kept: ", err)
+		s.Stale = StaleKeep
+	}
+
+	s.ordinals = make(map[string]int)
+	s.batches = make(chan elasticBatch, 2)
+	s.done = make(chan struct{})
+	go s.worker()
+	return nil
+}
+
+func (s *ElasticSink) newClient() (*http.Client, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if s.CACert != "" || s.Insecure {
+		cfg := &tls.Config{InsecureSkipVerify: s.Insecure}
+		if s.CACert != "" {
+			pem, err := ioutil.ReadFile(s.CACert)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found on %s", s.CACert)
+			}
+			cfg.RootCAs = pool
+		}
+		tr.TLSClientConfig = cfg
+	}
+	return &http.Client{Transport: tr, Timeout: time.Minute}, nil
+}
+
+// createIndex creates the index when it does not exist. The documents
+// of an existing Elasticsearch 6 index are written with its mapping
+// type, as it can only have one.
+func (s *ElasticSink) createIndex() error {
+	status, _, err := s.request("HEAD", "/"+s.index, nil, "")
+	if err != nil {
+		return err
+	}
+	if status == http.StatusOK {
+		if s.docType == "" {
+			return nil
+		}
+		t, err := s.mappingType()
+		if err != nil {
+			return err
+		}
+		if t != "" && t != s.docType {
+			log.Info("Writing to the ", t, " mapping type of index ", s.index)
+			s.docType = t
+		}
+		return nil
+	}
+
+	log.Info("Creating index " + s.index)
+	return s.do("PUT", "/"+s.index, nil, nil)
+}
+
+// mappingType returns the mapping type of the index, e.g. page on the
+// indices of the crawler v1, or "" when it has none yet.
+func (s *ElasticSink) mappingType() (string, error) {
+	var res map[string]struct {
+		Mappings map[string]json.RawMessage `json:"mappings"`
+	}
+	if err := s.do("GET", "/"+s.index+"/_mapping", nil, &res); err != nil {
+		return "", err
+	}
+	var types []string
+	for _, idx := range res {
+		for t := range idx.Mappings {
+			types = append(types, t)
+		}
+	}
+	sort.Strings(types)
+	if len(types) > 1 && types[0] != types[len(types)-1] {
+		return "", fmt.Errorf("index %s has the mapping types %s, it can not be written to", s.index, strings.Join(types, ", "))
+	}
+	if len(types) == 0 {
+		return "", nil
+	}
+	return types[0], nil
+}
+
+// putTemplate installs the index template of the index name template,
+// so the indices created with it get the mapping of the normalised
+// records.
+func (s *ElasticSink) putTemplate() error {
+	pattern := s.pattern()
+	name := "gocrawlit-" + strings.Trim(strings.Replace(pattern, "*", "", -1), "-_.")
+	path := "/_template/" + name
+	if s.composable {
+		path = "/_index_template/" + name
+	}
+	b, err := json.Marshal(elasticTemplate([]string{pattern}, s.composable, s.docType))
+	if err != nil {
+		return err
+	}
+	return s.do("PUT", path, b, nil)
+}
+
+// putMapping adds the mapping to an index that may have been created
+// before the template. The fields the stale documents are looked up by
+// must be exact values, so it fails when they were mapped otherwise.
+func (s *ElasticSink) putMapping() error {
+	path := "/" + s.index + "/_mapping"
+	if s.docType != "" {
+		path += "/" + s.docType
+	}
+	b, err := json.Marshal(elasticMapping())
+	if err != nil {
+		return err
+	}
+	return s.do("PUT", path, b, nil)
+}
+
+// host returns the host of the seed URL.
+func (s *ElasticSink) host() string {
+	if s.crawler == nil || s.crawler.BaseURL == nil {
+		return ""
+	}
+	return s.crawler.BaseURL.Host
+}
+
+func (s *ElasticSink) crawlID() string {
+	if s.crawler == nil {
+		return ""
+	}
+	return s.crawler.CrawlID
+}
+
+// pattern returns the pattern of the index names of the site.
+func (s *ElasticSink) pattern() string {
+	return indexPattern(s.Index, s.host())
+}
+
+// seed returns the seed URL of the crawl.
+func (s *ElasticSink) seed() string {
+	if s.crawler == nil || s.crawler.BaseURL == nil {
+		return ""
+	}
+	return s.crawler.BaseURL.String()
+}
+
+// documentID returns the ID of the document of a record: a hash of the
+// page and the record identity. Records are identified by their
+// extractor, source and the @id of their entities, the ones without
+// them by their types and position among the similar records of the
+// page instead.
+func (s *ElasticSink) documentID(r Record) string {
+	var ids, types []string
+	for _, e := range r.Entities() {
+		ids = append(ids, e.ID)
+		types = append(types, e.Types...)
+	}
+	sort.Strings(ids)
+
+	identity := fmt.Sprintf("%s %s id %s", r.Extractor, r.Source, strings.Join(ids, " "))
+	if len(ids) == 0 || ids[0] == "" {
+		key := strings.Join([]string{r.Page, r.Extractor, r.Source, strings.Join(types, " ")}, "\n")
+		identity = fmt.Sprintf("%s %s %s #%d", r.Extractor, r.Source, strings.Join(types, " "), s.ordinals[key])
+		s.ordinals[key]++
+	}
+
+	return fmt.Sprintf("%x", sha1.Sum([]byte(r.Page+"\n"+identity)))
+}
+
+// Write adds the record to the current batch.
+func (s *ElasticSink) Write(r Record) error {
+	d := elasticDocument(r)
+	d["crawl_id"] = r.CrawlID
+	d["seed"] = s.seed()
+	doc, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	meta := map[string]string{"_index": s.index, "_id": s.documentID(r)}
+	if s.docType != "" {
+		meta["_type"] = s.docType
+	}
+	action, err := json.Marshal(map[string]interface{}{"index": meta})
+	if err != nil {
+		return err
+	}
+
+	s.buf.Write(action)
+	s.buf.WriteByte('\n')
+	s.buf.Write(doc)
+	s.buf.WriteByte('\n')
+	s.n++
+
+	if s.n >= s.BatchSize {
+		s.enqueue()
+	}
+	return nil
+}
+
+// enqueue hands the current batch to the worker.
+func (s *ElasticSink) enqueue() {
+	if s.n == 0 {
+		return
+	}
+	b := elasticBatch{body: append([]byte(nil), s.buf.Bytes()...), n: s.n}
+	s.buf.Reset()
+	s.n = 0
+
+	s.pending.Add(1)
+	s.batches <- b
+}
+
+// Flush sends the current batch and waits until every batch has been
+// indexed. It fails when documents were rejected since the last flush.
+func (s *ElasticSink) Flush() error {
+	s.enqueue()
+	s.pending.Wait()
+
+	failed := atomic.LoadInt64(&s.failed)
+	if n := failed - s.reported; n > 0 {
+		s.reported = failed
+		return fmt.Errorf("%d documents failed to index on %s", n, s.index)
+	}
+	return nil
+}
+
+// Close stops the worker and logs the indexing counts. When the crawl
+// completed without failures it cleans up the stale documents, unless
+// some pages could not be fetched, points the alias at the index and
+// deletes the old indices.
+func (s *ElasticSink) Close() error {
+	s.enqueue()
+	close(s.batches)
+	<-s.done
+	if err := s.deadLetter.close(); err != nil {
+		log.Error("Error closing the dead letter file of ", s.index, " ", err)
+	}
+
+	log.WithFields(log.Fields{
+		"Index":   s.index,
+		"Indexed": s.Indexed(),
+		"Failed":  s.Failed(),
+	}).Info("Indexing finished")
+
+	if s.crawler == nil || (s.Stale == StaleKeep && s.Alias == "" && s.Keep == 0) {
+		return nil
+	}
+	if !s.crawler.Completed() || s.Failed() > 0 {
+		log.Warn("Crawl not completed or with indexing failures, stale documents, aliases and old indices of ", s.index, " left as they are")
+		return nil
+	}
+
+	if s.Stale != StaleKeep {
+		if n := s.crawler.FetchErrors(); n > 0 {
+			log.Warn(n, " pages could not be fetched, stale documents of ", s.index, " left as they are")
+		} else if err := s.cleanup(s.crawler.CrawlID); err != nil {
+			return err
+		}
+	}
+	if s.Alias != "" {
+		if err := s.updateAlias(); err != nil {
+			return err
+		}
+	}
+	if s.Keep > 0 {
+		return s.applyRetention()
+	}
+	return nil
+}
+
+// cleanup deletes or flags the documents of the seed that were not
+// indexed by the given crawl.
+func (s *ElasticSink) cleanup(crawlID string) error {
+	if err := s.do("POST", "/"+s.index+"/_refresh", nil, nil); err != nil {
+		return err
+	}
+
+	query := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter":   map[string]interface{}{"term": map[string]string{"seed": s.seed()}},
+			"must_not": map[string]interface{}{"term": map[string]string{"crawl_id": crawlID}},
+		},
+	}
+	path := "/" + s.index + "/_delete_by_query?conflicts=proceed&refresh=true"
+	body := map[string]interface{}{"query": query}
+	if s.Stale == StaleFlag {
+		path = "/" + s.index + "/_update_by_query?conflicts=proceed&refresh=true"
+		body["script"] = map[string]string{"source": "ctx._source.stale = true", "lang": "painless"}
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	var res struct {
+		Deleted int `json:"deleted"`
+		Updated int `json:"updated"`
+	}
+	if err := s.do("POST", path, b, &res); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"Index":   s.index,
+		"Deleted": res.Deleted,
+		"Flagged": res.Updated,
+	}).Info("Stale documents cleaned up")
+	return nil
+}
+
+// Indexed returns the number of documents indexed.
+func (s *ElasticSink) Indexed() int64 {
+	return atomic.LoadInt64(&s.indexed)
+}
+
+// Failed returns the number of documents that could not be indexed.
+func (s *ElasticSink) Failed() int64 {
+	return atomic.LoadInt64(&s.failed)
+}
+
+func (s *ElasticSink) worker() {
+	defer close(s.done)
+	for b := range s.batches {
+		s.bulk(b)
+		s.pending.Done()
+	}
+}
+
+// bulk sends a batch and counts the documents indexed and failed.
+func (s *ElasticSink) bulk(b elasticBatch) {
+	var res struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+
+	err := s.Retry.do("Bulk request", log.Fields{"Index": s.index}, func() (bool, time.Duration, error) {
+		status, h, body, err := s.roundTrip("POST", "/_bulk", b.body, "application/x-ndjson")
+		if err != nil {
+			return true, 0, err
+		}
+		if status >= 300 {
+			return retryable(status), retryAfter(h), fmt.Errorf("bulk request failed with status %d: %s", status, excerpt(body))
+		}
+		return false, 0, json.Unmarshal(body, &res)
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Index":     s.index,
+			"Documents": b.n,
+			"Error":     err,
+		}).Error("Error indexing documents")
+		atomic.AddInt64(&s.failed, int64(b.n))
+		s.writeDeadLetter(b.body)
+		return
+	}
+
+	// every action and its document are two lines of the request
+	lines := bytes.SplitAfter(b.body, []byte("\n"))
+	var failed int64
+	var rejected []byte
+	for i, item := range res.Items {
+		for _, r := range item {
+			if r.Status >= 300 {
+				if failed == 0 {
+					log.WithFields(log.Fields{
+						"Index":  s.index,
+						"Status": r.Status,
+						"Error":  string(r.Error),
+					}).Error("Document rejected")
+				}
+				failed++
+				if 2*i+1 < len(lines) {
+					rejected = append(rejected, lines[2*i]...)
+					rejected = append(rejected, lines[2*i+1]...)
+				}
+			}
+		}
+	}
+	atomic.AddInt64(&s.failed, failed)
+	atomic.AddInt64(&s.indexed, int64(len(res.Items))-failed)
+	if len(rejected) > 0 {
+		s.writeDeadLetter(rejected)
+	}
+}
+
+// writeDeadLetter appends bulk actions that failed to the dead letter
+// file, if set.
+func (s *ElasticSink) writeDeadLetter(actions []byte) {
+	if s.DeadLetter == "" {
+		return
+	}
+	if err := s.deadLetter.write(s.DeadLetter, "documents not indexed", actions); err != nil {
+		log.Error("Error writing the dead letter file of ", s.index, " ", err)
+	}
+}
+
+// do sends a request and decodes the JSON response into v, if not nil.
+func (s *ElasticSink) do(method, path string, body []byte, v interface{}) error {
+	status, res, err := s.request(method, path, body, "application/json")
+	if err != nil {
+		return err
+	}
+	if status >= 300 {
+		return fmt.Errorf("%s %s failed with status %d: %s", method, path, status, excerpt(res))
+	}
+	if v != nil {
+		return json.Unmarshal(res, v)
+	}
+	return nil
+}
+
+// request sends an authenticated request and returns the status code
+// and body of the response.
+func (s *ElasticSink) request(method, path string, body []byte, contentType string) (int, []byte, error) {
+	status, _, res, err := s.roundTrip(method, path, body, contentType)
+	return status, res, err
+}
+
+// roundTrip sends an authenticated request and returns the status code,
+// headers and body of the response.
+func (s *ElasticSink) roundTrip(method, path string, body []byte, contentType string) (int, http.Header, []byte, error) {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, s.URL+path, rd)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	switch {
+	case s.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+s.APIKey)
+	case s.Username != "":
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	res, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header, res, err
+}
+
+func excerpt(b []byte) string {
+	s := strings.TrimSpace(string(b))
+	if len(s) > 512 {
+		s = s[:512]
+	}
+	return s
+}
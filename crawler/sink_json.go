@@ -0,0 +1,311 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Groupings of the aggregate JSON document.
+const (
+	GroupByPage = "page"
+	GroupByType = "type"
+)
+
+func init() {
+	RegisterSink("json", func(cw *Crawler, params map[string]string) (Sink, error) {
+		name := params["file"]
+		if name == "" {
+			name = cw.outputBase() + ".json"
+		}
+		group := params["group"]
+		if group == "" {
+			group = GroupByPage
+		}
+		if group != GroupByPage && group != GroupByType {
+			return nil, fmt.Errorf("unknown grouping %q, use %s or %s", group, GroupByPage, GroupByType)
+		}
+
+		s := NewAggregateSink(cw, name, group)
+		if err := outputFileParams(s.Output, params); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}, "file", "group", "exists", "compress")
+}
+
+// AggregateSink writes a single JSON document with the crawl information
+// and the metadata found, grouped by page or by entity type. An entity
+// is listed under each of its types, untyped ones under Thing. Records
+// are spilled to a temporary file as they come and the document is
+// written from it on Close, so only their offsets are kept in memory.
+type AggregateSink struct {
+	Output *OutputFile
+	Group  string
+
+	crawler   *Crawler
+	startedAt time.Time
+	tmp       *os.File
+	w         *bufio.Writer
+	offset    int64
+	records   int
+	pages     []string
+	byPage    map[string][]spill
+	byType    map[string][]spill
+}
+
+// spill is the position of a record on the temporary file, and of an
+// entity among the ones of the record.
+type spill struct {
+	offset int64
+	size   int
+	entity int
+}
+
+// NewAggregateSink creates a sink writing the document of a crawl to
+// the given file, grouping the metadata by page or by type.
+func NewAggregateSink(cw *Crawler, fileName, group string) *AggregateSink {
+	return &AggregateSink{Output: NewOutputFile(fileName), Group: group, crawler: cw}
+}
+
+// Open creates the output and the temporary files.
+func (s *AggregateSink) Open() error {
+	tmp, err := ioutil.TempFile("", "gocrawlit-*.jsonl")
+	if err != nil {
+		return err
+	}
+	if err := s.Output.Open(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	log.Info("Writing JSON document to ", s.Output.Name)
+
+	s.tmp = tmp
+	s.w = bufio.NewWriter(tmp)
+	s.startedAt = time.Now().UTC()
+	s.byPage = make(map[string][]spill)
+	s.byType = make(map[string][]spill)
+	return nil
+}
+
+// Write spills the record to the temporary file.
+func (s *AggregateSink) Write(r Record) error {
+	b, err := json.Marshal(r.Envelope())
+	if err != nil {
+		return err
+	}
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+	sp := spill{offset: s.offset, size: len(b)}
+	s.offset += int64(len(b))
+	s.records++
+
+	if _, ok := s.byPage[r.Page]; !ok {
+		s.pages = append(s.pages, r.Page)
+	}
+	s.byPage[r.Page] = append(s.byPage[r.Page], sp)
+
+	if s.Group == GroupByType {
+		for i, e := range r.Entities() {
+			sp.entity = i
+			types := e.Types
+			if len(types) == 0 {
+				types = []string{"Thing"}
+			}
+			for _, t := range types {
+				s.byType[t] = append(s.byType[t], sp)
+			}
+		}
+	}
+	return nil
+}
+
+// Flush writes the spilled records to the temporary file.
+func (s *AggregateSink) Flush() error {
+	return s.w.Flush()
+}
+
+// Close writes the document and removes the temporary file.
+func (s *AggregateSink) Close() error {
+	defer os.Remove(s.tmp.Name())
+	defer s.tmp.Close()
+
+	err := s.writeDocument()
+	if cerr := s.Output.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		log.WithFields(log.Fields{
+			"Pages":   len(s.pages),
+			"Records": s.records,
+		}).Info("JSON document written to ", s.Output.Name)
+	}
+	return err
+}
+
+// aggregatePage is a page of the document grouped by page.
+type aggregatePage struct {
+	Page        string            `json:"page"`
+	FinalURL    string            `json:"final_url,omitempty"`
+	Status      int               `json:"status,omitempty"`
+	FetchedAt   *time.Time        `json:"fetched_at,omitempty"`
+	ContentHash string            `json:"content_hash,omitempty"`
+	Records     []aggregateRecord `json:"records"`
+}
+
+// aggregateRecord is the metadata of a record found on a page.
+type aggregateRecord struct {
+	Extractor string                 `json:"extractor,omitempty"`
+	Block     int                    `json:"block"`
+	Source    string                 `json:"source,omitempty"`
+	Repairs   []string               `json:"repairs,omitempty"`
+	Pages     []string               `json:"pages,omitempty"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// aggregateEntity is an entity of the document grouped by type.
+type aggregateEntity struct {
+	Page      string                 `json:"page"`
+	Source    string                 `json:"source,omitempty"`
+	Extractor string                 `json:"extractor,omitempty"`
+	ID        string                 `json:"id,omitempty"`
+	Pages     []string               `json:"pages,omitempty"`
+	Entity    map[string]interface{} `json:"entity"`
+}
+
+func (s *AggregateSink) writeDocument() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+
+	seed := ""
+	if s.crawler.BaseURL != nil {
+		seed = s.crawler.BaseURL.String()
+	}
+	header, err := json.Marshal(struct {
+		Version     int       `json:"version"`
+		CrawlID     string    `json:"crawl_id,omitempty"`
+		Seed        string    `json:"seed,omitempty"`
+		StartedAt   time.Time `json:"started_at"`
+		FinishedAt  time.Time `json:"finished_at"`
+		Completed   bool      `json:"completed"`
+		PageCount   int       `json:"page_count"`
+		RecordCount int       `json:"record_count"`
+	}{EnvelopeVersion, s.crawler.CrawlID, seed, s.startedAt, time.Now().UTC(), s.crawler.Completed(), len(s.pages), s.records})
+	if err != nil {
+		return err
+	}
+
+	// A write error is kept by w and returned by its Flush, the writes
+	// after it doing nothing
+	w := bufio.NewWriter(s.Output)
+
+	// The header without its closing brace, the groups follow
+	w.Write(header[:len(header)-1])
+
+	if s.Group == GroupByType {
+		err = s.writeTypes(w)
+	} else {
+		err = s.writePages(w)
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteString("}\n")
+	return w.Flush()
+}
+
+func (s *AggregateSink) writePages(w *bufio.Writer) error {
+	w.WriteString(`,"pages":[`)
+	for i, page := range s.pages {
+		p := aggregatePage{Page: page}
+		for _, sp := range s.byPage[page] {
+			e, err := s.read(sp)
+			if err != nil {
+				return err
+			}
+			if e.FetchedAt != nil {
+				p.FinalURL, p.Status, p.FetchedAt, p.ContentHash = e.FinalURL, e.Status, e.FetchedAt, e.ContentHash
+			}
+			p.Records = append(p.Records, aggregateRecord{e.Extractor, e.Block, e.Source, e.Repairs, e.Pages, e.Data})
+		}
+
+		b, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			w.WriteString(",")
+		}
+		w.Write(b)
+	}
+	w.WriteString("]")
+	return nil
+}
+
+func (s *AggregateSink) writeTypes(w *bufio.Writer) error {
+	types := make([]string, 0, len(s.byType))
+	for t := range s.byType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	w.WriteString(`,"types":{`)
+	for i, t := range types {
+		name, _ := json.Marshal(t)
+		if i > 0 {
+			w.WriteString(",")
+		}
+		w.Write(name)
+		w.WriteString(":[")
+
+		n := 0
+		for _, sp := range s.byType[t] {
+			e, err := s.read(sp)
+			if err != nil {
+				return err
+			}
+			es := e.Record().Entities()
+			if sp.entity >= len(es) {
+				log.WithFields(log.Fields{
+					"URL":    e.Page,
+					"Type":   t,
+					"Entity": sp.entity,
+				}).Warn("Entity not found in the spilled record")
+				continue
+			}
+			en := es[sp.entity]
+			b, err := json.Marshal(aggregateEntity{e.Page, e.Source, e.Extractor, en.ID, e.Pages, en.Data})
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				w.WriteString(",")
+			}
+			n++
+			w.Write(b)
+		}
+		w.WriteString("]")
+	}
+	w.WriteString("}")
+	return nil
+}
+
+// read reads back a spilled record.
+func (s *AggregateSink) read(sp spill) (Envelope, error) {
+	var e Envelope
+	b := make([]byte, sp.size)
+	if _, err := s.tmp.ReadAt(b, sp.offset); err != nil {
+		return e, err
+	}
+	err := json.Unmarshal(b, &e)
+	return e, err
+}
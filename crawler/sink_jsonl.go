@@ -0,0 +1,143 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterSink("jsonl", func(cw *Crawler, params map[string]string) (Sink, error) {
+		name := params["file"]
+		if name == "" {
+			name = cw.OutputFileName
+		}
+		s := NewJSONLSink(name)
+		if err := outputFileParams(s.Output, params); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}, append([]string{"file"}, outputFileKeys...)...)
+}
+
+// JSONLSink writes the envelope of every record as a line of JSON, as
+// it scraps.
+type JSONLSink struct {
+	Output *OutputFile
+}
+
+// NewJSONLSink creates a sink writing to the given file.
+func NewJSONLSink(fileName string) *JSONLSink {
+	return &JSONLSink{Output: NewOutputFile(fileName)}
+}
+
+// Open creates the output file.
+func (s *JSONLSink) Open() error {
+	if err := s.Output.Open(); err != nil {
+		return err
+	}
+	log.Info("Writing records to ", s.Output.Name)
+	return nil
+}
+
+// Write appends the record to the file.
+func (s *JSONLSink) Write(r Record) error {
+	j, err := json.Marshal(r.Envelope())
+	if err != nil {
+		return err
+	}
+	return s.Output.WriteRecord(append(j, '\n'))
+}
+
+// Flush writes the buffered records to the file.
+func (s *JSONLSink) Flush() error {
+	return s.Output.Flush()
+}
+
+// Close closes the output file.
+func (s *JSONLSink) Close() error {
+	return s.Output.Close()
+}
+
+// Magic numbers of the compressed outputs.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ReadJSONL reads the records of a JSON lines file written by the jsonl
+// sink and calls fn for each of them. Files compressed with gzip or zstd
+// are told by their first bytes and decompressed. Lines that are not an
+// envelope are logged and skipped.
+func ReadJSONL(r io.Reader, fn func(Record) error) error {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	r = br
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		z, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer z.Close()
+		r = z
+	case bytes.HasPrefix(magic, zstdMagic):
+		z, err := zstd.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer z.Close()
+		r = z
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e Envelope
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil || e.Version == 0 {
+			if err == nil {
+				err = fmt.Errorf("no envelope version")
+			}
+			log.WithFields(log.Fields{
+				"Line":  line,
+				"Error": err,
+			}).Warn("Skipping JSON line")
+			continue
+		}
+		if e.Version > EnvelopeVersion {
+			return fmt.Errorf("line %d: unsupported envelope version %d", line, e.Version)
+		}
+		if err := fn(e.Record()); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// ReadJSONLFiles reads the records of several JSON lines files in order,
+// e.g. the parts of a rotated output.
+func ReadJSONLFiles(names []string, fn func(Record) error) error {
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = ReadJSONL(f, fn)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
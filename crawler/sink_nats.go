@@ -0,0 +1,216 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultSubject is the subject or routing key template of the records
+// published to a message broker.
+const DefaultSubject = "bioschemas.{host}.{type}"
+
+var subjectToken = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// messageSubject replaces the {host} and {type} placeholders of a
+// subject template with the host of the record page and the type of its
+// first entity, or none. Dots, wildcards and spaces separate or match
+// tokens on NATS subjects and AMQP routing keys, they are replaced by
+// underscores.
+func messageSubject(tmpl string, r Record) string {
+	host := ""
+	if u, err := url.Parse(r.Page); err == nil {
+		host = u.Host
+	}
+	t := "none"
+	if es := r.Entities(); len(es) > 0 && es[0].Type() != "" {
+		t = es[0].Type()
+	}
+	return strings.NewReplacer(
+		"{host}", subjectToken.ReplaceAllString(host, "_"),
+		"{type}", subjectToken.ReplaceAllString(shortType(t), "_"),
+	).Replace(tmpl)
+}
+
+func init() {
+	RegisterSink("nats", func(cw *Crawler, params map[string]string) (Sink, error) {
+		u := params["url"]
+		if u == "" {
+			u = nats.DefaultURL
+		}
+		s := NewNATSSink(u)
+		s.Username = params["user"]
+		s.Password = params["password"]
+		s.Token = params["token"]
+		if v := params["subject"]; v != "" {
+			s.Subject = v
+		}
+		if v := params["jetstream"]; v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid nats jetstream %q", v)
+			}
+			s.JetStream = b
+		}
+		if v := params["batch"]; v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid nats batch size %q", v)
+			}
+			s.BatchSize = n
+		}
+		return s, nil
+	}, "url", "user", "password", "token", "subject", "jetstream", "batch")
+}
+
+// NATSSink publishes the envelope of every record to a NATS subject
+// built from the Subject template, see messageSubject. With JetStream
+// the subjects must belong to a stream and every message is
+// acknowledged by the server, otherwise the messages are only known to
+// have reached the server. Delivery is checked every BatchSize messages
+// and on Flush, messages that were not acknowledged are counted and
+// reported.
+type NATSSink struct {
+	URL       string
+	Username  string
+	Password  string
+	Token     string
+	Subject   string
+	JetStream bool
+	BatchSize int
+	Timeout   time.Duration
+
+	nc      *nats.Conn
+	js      nats.JetStreamContext
+	futures []nats.PubAckFuture
+	pending int
+	sent    int
+	failed  int
+}
+
+// NewNATSSink creates a sink publishing to the given NATS server.
+func NewNATSSink(url string) *NATSSink {
+	return &NATSSink{
+		URL:       url,
+		Subject:   DefaultSubject,
+		BatchSize: 100,
+		Timeout:   10 * time.Second,
+	}
+}
+
+// Open connects to the server.
+func (s *NATSSink) Open() error {
+	opts := []nats.Option{nats.Name("bioschemas-gocrawlit")}
+	switch {
+	case s.Token != "":
+		opts = append(opts, nats.Token(s.Token))
+	case s.Username != "":
+		opts = append(opts, nats.UserInfo(s.Username, s.Password))
+	}
+
+	nc, err := nats.Connect(s.URL, opts...)
+	if err != nil {
+		return err
+	}
+	if s.JetStream {
+		js, err := nc.JetStream()
+		if err != nil {
+			nc.Close()
+			return err
+		}
+		s.js = js
+	}
+	s.nc = nc
+	s.futures, s.pending, s.sent, s.failed = nil, 0, 0, 0
+	log.Info("Publishing records to ", s.URL, " on ", s.Subject)
+	return nil
+}
+
+// Write publishes the record.
+func (s *NATSSink) Write(r Record) error {
+	b, err := json.Marshal(r.Envelope())
+	if err != nil {
+		return err
+	}
+	subject := messageSubject(s.Subject, r)
+
+	if s.js != nil {
+		f, err := s.js.PublishAsync(subject, b)
+		if err != nil {
+			s.failed++
+			return err
+		}
+		s.futures = append(s.futures, f)
+	} else if err := s.nc.Publish(subject, b); err != nil {
+		s.failed++
+		return err
+	}
+
+	s.pending++
+	if s.pending >= s.BatchSize {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush waits for the published messages to be acknowledged.
+func (s *NATSSink) Flush() error {
+	if s.pending == 0 {
+		return nil
+	}
+	pending := s.pending
+	s.pending = 0
+
+	if s.js == nil {
+		if err := s.nc.FlushTimeout(s.Timeout); err != nil {
+			s.failed += pending
+			return err
+		}
+		s.sent += pending
+		return nil
+	}
+
+	futures := s.futures
+	s.futures = nil
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	var failed int
+	var lastErr error
+	for _, f := range futures {
+		select {
+		case <-f.Ok():
+			s.sent++
+		case err := <-f.Err():
+			failed++
+			lastErr = err
+		case <-ctx.Done():
+			failed++
+			lastErr = fmt.Errorf("no acknowledgement after %s", s.Timeout)
+		}
+	}
+	if failed > 0 {
+		s.failed += failed
+		return fmt.Errorf("%d of %d NATS messages not acknowledged: %v", failed, len(futures), lastErr)
+	}
+	return nil
+}
+
+// Close logs the delivery counts and closes the connection.
+func (s *NATSSink) Close() error {
+	log.WithFields(log.Fields{
+		"URL":    s.URL,
+		"Sent":   s.sent,
+		"Failed": s.failed,
+	}).Info("NATS records published")
+	s.nc.Close()
+	return nil
+}
@@ -0,0 +1,212 @@
+package crawler
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterSink("parquet", func(cw *Crawler, params map[string]string) (Sink, error) {
+		name := params["file"]
+		if name == "" {
+			name = cw.outputBase() + ".parquet"
+		}
+		props, ok := params["properties"]
+		if !ok {
+			props = strings.TrimSuffix(name, filepath.Ext(name)) + "_properties.parquet"
+		}
+		exists, err := existsParam(params)
+		if err != nil {
+			return nil, err
+		}
+		s := NewParquetSink(name, props)
+		s.Output.Exists = exists
+		if s.Properties != nil {
+			s.Properties.Exists = exists
+		}
+		return s, nil
+	}, "file", "properties", "exists")
+}
+
+// parquetEntity is a row of the entities table.
+type parquetEntity struct {
+	Entity      string    `parquet:"entity"`
+	Version     int32     `parquet:"version"`
+	CrawlID     string    `parquet:"crawl_id,optional"`
+	Page        string    `parquet:"page"`
+	FinalURL    string    `parquet:"final_url,optional"`
+	Status      int32     `parquet:"status,optional"`
+	FetchedAt   time.Time `parquet:"fetched_at,timestamp,optional"`
+	ContentHash string    `parquet:"content_hash,optional"`
+	Extractor   string    `parquet:"extractor"`
+	Block       int32     `parquet:"block"`
+	Source      string    `parquet:"source,optional"`
+	Type        string    `parquet:"type,optional"`
+	Types       []string  `parquet:"types,list"`
+	ID          string    `parquet:"id,optional"`
+	Data        string    `parquet:"data,json"`
+	Pages       []string  `parquet:"pages,list"`
+}
+
+// parquetProperty is a row of the properties table.
+type parquetProperty struct {
+	Entity   string `parquet:"entity"`
+	CrawlID  string `parquet:"crawl_id,optional"`
+	Page     string `parquet:"page"`
+	Type     string `parquet:"type,optional"`
+	Path     string `parquet:"path"`
+	Position int32  `parquet:"position"`
+	Value    string `parquet:"value"`
+}
+
+// ParquetSink writes the entities found to a Parquet file with a row per
+// entity: the envelope columns, its type and @id, and the entity itself
+// as a JSON column. When Properties is set the flattened properties are
+// also written to it, a row per property value with the path and the
+// position of the value, joined to the entities by the entity column.
+type ParquetSink struct {
+	Output     *OutputFile
+	Properties *OutputFile
+
+	entities *parquet.GenericWriter[parquetEntity]
+	props    *parquet.GenericWriter[parquetProperty]
+}
+
+// NewParquetSink creates a sink writing the entities to fileName and
+// their properties to propertiesFile, if not empty.
+func NewParquetSink(fileName, propertiesFile string) *ParquetSink {
+	s := &ParquetSink{Output: NewOutputFile(fileName)}
+	if propertiesFile != "" {
+		s.Properties = NewOutputFile(propertiesFile)
+	}
+	return s
+}
+
+// Open creates the output files.
+func (s *ParquetSink) Open() error {
+	if err := s.Output.Open(); err != nil {
+		return err
+	}
+	s.entities = parquet.NewGenericWriter[parquetEntity](s.Output, parquet.Compression(&parquet.Snappy))
+	log.Info("Writing entities to ", s.Output.Name)
+
+	if s.Properties != nil {
+		if err := s.Properties.Open(); err != nil {
+			s.Output.Close()
+			return err
+		}
+		s.props = parquet.NewGenericWriter[parquetProperty](s.Properties, parquet.Compression(&parquet.Snappy))
+		log.Info("Writing entity properties to ", s.Properties.Name)
+	}
+	return nil
+}
+
+// Write adds a row for every entity of the record, and for every
+// property value to the properties table.
+func (s *ParquetSink) Write(r Record) error {
+	e := r.Envelope()
+	for i, en := range r.Entities() {
+		data, err := json.Marshal(en.Data)
+		if err != nil {
+			return err
+		}
+
+		key := parquetEntityKey(r, i, data)
+		row := parquetEntity{
+			Entity:      key,
+			Version:     int32(e.Version),
+			CrawlID:     e.CrawlID,
+			Page:        e.Page,
+			FinalURL:    e.FinalURL,
+			Status:      int32(e.Status),
+			ContentHash: e.ContentHash,
+			Extractor:   e.Extractor,
+			Block:       int32(e.Block),
+			Source:      e.Source,
+			Type:        en.Type(),
+			Types:       en.Types,
+			ID:          en.ID,
+			Data:        string(data),
+			Pages:       e.Pages,
+		}
+		if e.FetchedAt != nil {
+			row.FetchedAt = *e.FetchedAt
+		}
+		if _, err := s.entities.Write([]parquetEntity{row}); err != nil {
+			return err
+		}
+
+		if s.props == nil {
+			continue
+		}
+		var props []parquetProperty
+		positions := make(map[string]int32)
+		for _, p := range en.Properties() {
+			props = append(props, parquetProperty{
+				Entity:   key,
+				CrawlID:  e.CrawlID,
+				Page:     e.Page,
+				Type:     en.Type(),
+				Path:     p.Path,
+				Position: positions[p.Path],
+				Value:    p.Value,
+			})
+			positions[p.Path]++
+		}
+		if _, err := s.props.Write(props); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parquetEntityKey identifies the i-th entity of a record within a crawl.
+// The representations negotiated for a page share its source, they are
+// told apart by their media type. A deduplicated entity is written with
+// the record it was first found in, next to what is left of the record,
+// it is told apart by its content.
+func parquetEntityKey(r Record, i int, data []byte) string {
+	key := fmt.Sprintf("%s\n%s\n%s\n%s\n%d\n%d\n%d", r.CrawlID, r.Page, r.Extractor, r.Source, r.Block, r.Part, i)
+	if rep, _ := r.Metadata["representation"].(string); rep != "" {
+		key += "\n" + rep
+	}
+	if len(r.Pages) > 0 {
+		key += "\n" + string(data)
+	}
+	return fmt.Sprintf("%x", sha1.Sum([]byte(key)))
+}
+
+// Flush writes the buffered rows as a row group.
+func (s *ParquetSink) Flush() error {
+	if err := s.entities.Flush(); err != nil {
+		return err
+	}
+	if s.props != nil {
+		return s.props.Flush()
+	}
+	return nil
+}
+
+// Close writes the file footers and closes the files.
+func (s *ParquetSink) Close() error {
+	err := s.entities.Close()
+	if cerr := s.Output.Close(); err == nil {
+		err = cerr
+	}
+	if s.props != nil {
+		if perr := s.props.Close(); err == nil {
+			err = perr
+		}
+		if cerr := s.Properties.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,201 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RDF output formats.
+const (
+	FormatNQuads = "nquads"
+	FormatTurtle = "turtle"
+)
+
+func init() {
+	RegisterSink("rdf", func(cw *Crawler, params map[string]string) (Sink, error) {
+		format := params["format"]
+		if format == "" {
+			format = FormatNQuads
+		}
+		var ext string
+		switch format {
+		case FormatNQuads:
+			ext = ".nq"
+		case FormatTurtle:
+			ext = ".ttl"
+		default:
+			return nil, fmt.Errorf("unknown RDF format %q, use %s or %s", format, FormatNQuads, FormatTurtle)
+		}
+
+		name := params["file"]
+		if name == "" {
+			name = cw.outputBase() + ext
+		}
+		s := NewRDFSink(name, format)
+		if err := outputFileParams(s.Output, params); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}, append([]string{"file", "format"}, outputFileKeys...)...)
+}
+
+// turtlePrefixes are the prefixes used to abbreviate IRIs in Turtle output.
+var turtlePrefixes = []struct{ prefix, ns string }{
+	{"rdf", rdfNS},
+	{"schema", schemaOrgVocab},
+	{"xsd", xsdNS},
+}
+
+var turtleLocalName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// RDFSink writes the records as RDF. In N-Quads every statement is
+// written as it scraps, in the named graph of the page it was found on.
+// Turtle has no graphs, the statements of all the pages are merged and
+// written sorted when the sink is closed.
+type RDFSink struct {
+	Output *OutputFile
+	Format string
+
+	triples map[string]Triple
+}
+
+// NewRDFSink creates a sink writing to the given file in the given format.
+func NewRDFSink(fileName, format string) *RDFSink {
+	return &RDFSink{Output: NewOutputFile(fileName), Format: format}
+}
+
+// Open creates the output file.
+func (s *RDFSink) Open() error {
+	if err := s.Output.Open(); err != nil {
+		return err
+	}
+	log.Info("Writing RDF to ", s.Output.Name)
+	s.triples = make(map[string]Triple)
+	return nil
+}
+
+// Write converts the record to triples and writes or keeps them.
+func (s *RDFSink) Write(r Record) error {
+	ts := r.Triples()
+
+	if s.Format == FormatTurtle {
+		for _, t := range ts {
+			s.triples[t.String()] = t
+		}
+		return nil
+	}
+
+	if len(ts) == 0 {
+		return nil
+	}
+	var b bytes.Buffer
+	graph := NewIRI(r.Page)
+	for _, t := range ts {
+		fmt.Fprintf(&b, "%s %s %s %s .\n", t.Subject, t.Predicate, t.Object, graph)
+	}
+	return s.Output.WriteRecord(b.Bytes())
+}
+
+// Flush writes the buffered statements to the file.
+func (s *RDFSink) Flush() error {
+	return s.Output.Flush()
+}
+
+// Close writes the Turtle document, if any, and closes the output file.
+func (s *RDFSink) Close() error {
+	if s.Format == FormatTurtle {
+		ts := make([]Triple, 0, len(s.triples))
+		for _, t := range s.triples {
+			ts = append(ts, t)
+		}
+		if err := writeTurtle(s.Output, ts); err != nil {
+			s.Output.Close()
+			return err
+		}
+	}
+	return s.Output.Close()
+}
+
+// writeTurtle writes the triples as a Turtle document, grouped by
+// subject and sorted so the output only depends on the triples.
+func writeTurtle(w io.Writer, ts []Triple) error {
+	sort.Slice(ts, func(i, j int) bool {
+		a, b := ts[i], ts[j]
+		if a.Subject != b.Subject {
+			return a.Subject.String() < b.Subject.String()
+		}
+		if a.Predicate != b.Predicate {
+			// rdf:type goes first
+			if a.Predicate.Value == rdfType || b.Predicate.Value == rdfType {
+				return a.Predicate.Value == rdfType
+			}
+			return a.Predicate.String() < b.Predicate.String()
+		}
+		return a.Object.String() < b.Object.String()
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, p := range turtlePrefixes {
+		fmt.Fprintf(bw, "@prefix %s: <%s> .\n", p.prefix, p.ns)
+	}
+
+	for i, t := range ts {
+		switch {
+		case i > 0 && t.Subject == ts[i-1].Subject && t.Predicate == ts[i-1].Predicate:
+			fmt.Fprintf(bw, " ,\n\t\t%s", turtleTerm(t.Object))
+		case i > 0 && t.Subject == ts[i-1].Subject:
+			fmt.Fprintf(bw, " ;\n\t%s %s", turtlePredicate(t.Predicate), turtleTerm(t.Object))
+		default:
+			if i > 0 {
+				bw.WriteString(" .\n")
+			}
+			fmt.Fprintf(bw, "\n%s %s %s", turtleTerm(t.Subject), turtlePredicate(t.Predicate), turtleTerm(t.Object))
+		}
+	}
+	if len(ts) > 0 {
+		bw.WriteString(" .\n")
+	}
+	return bw.Flush()
+}
+
+func turtlePredicate(t Term) string {
+	if t.Value == rdfType {
+		return "a"
+	}
+	return turtleTerm(t)
+}
+
+// turtleTerm returns a term in Turtle syntax, abbreviating the IRIs of
+// the known prefixes.
+func turtleTerm(t Term) string {
+	switch t.Type {
+	case IRI:
+		return turtleIRI(t.Value)
+	case Literal:
+		s := `"` + escapeLiteral(t.Value) + `"`
+		if t.Language != "" {
+			return s + "@" + t.Language
+		}
+		if t.Datatype != "" && t.Datatype != xsdString {
+			return s + "^^" + turtleIRI(t.Datatype)
+		}
+		return s
+	}
+	return t.String()
+}
+
+func turtleIRI(iri string) string {
+	for _, p := range turtlePrefixes {
+		if local := strings.TrimPrefix(iri, p.ns); local != iri && turtleLocalName.MatchString(local) {
+			return p.prefix + ":" + local
+		}
+	}
+	return "<" + escapeIRI(iri) + ">"
+}
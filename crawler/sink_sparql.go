@@ -0,0 +1,232 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterSink("sparql", func(cw *Crawler, params map[string]string) (Sink, error) {
+		if params["endpoint"] == "" {
+			return nil, fmt.Errorf("the sparql sink needs an endpoint")
+		}
+		s := NewSPARQLSink(params["endpoint"])
+		s.Username = params["user"]
+		s.Password = params["password"]
+		s.Token = params["token"]
+
+		var err error
+		if v := params["batch"]; v != "" {
+			if s.BatchSize, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("invalid sparql batch size %q", v)
+			}
+		}
+		if err := retryParams(&s.Retry, "sparql", params); err != nil {
+			return nil, err
+		}
+
+		dl, ok := params["deadletter"]
+		if !ok {
+			dl = cw.outputBase() + "_deadletter.ru"
+		}
+		s.DeadLetter = dl
+		return s, nil
+	}, append([]string{"endpoint", "user", "password", "token", "batch", "deadletter"}, retryKeys...)...)
+}
+
+// SPARQLSink loads the triples of every page into its own named graph
+// of a triple store through the SPARQL 1.1 Update protocol. The first
+// time a page is written in a crawl its graph is dropped and inserted
+// again, so recrawled pages replace their previous statements. The
+// updates of a page are kept until the crawler tells it is done, and
+// batches are only made of done pages, so the drop and inserts of a
+// page go in a single request. Entities deduplicated across pages are
+// inserted when the crawl ends. Requests are retried as set by Retry,
+// the ones that still fail are appended to the DeadLetter SPARQL update file, if set, to
+// be sent again later.
+type SPARQLSink struct {
+	Endpoint string
+	Username string
+	Password string
+	Token    string
+
+	// BatchSize is the number of statements after which the updates
+	// are sent, once the page being written is done.
+	BatchSize int
+	Retry
+	Client     *http.Client
+	DeadLetter string
+
+	graphs     map[string]bool
+	records    map[string]bool
+	pages      map[string]*sparqlPage
+	ops        []string
+	pending    int
+	deadLetter deadLetter
+}
+
+// sparqlPage holds the updates of a page until it is done.
+type sparqlPage struct {
+	ops        []string
+	statements int
+}
+
+// NewSPARQLSink creates a sink for the given SPARQL Update endpoint.
+func NewSPARQLSink(endpoint string) *SPARQLSink {
+	return &SPARQLSink{
+		Endpoint:  endpoint,
+		BatchSize: 1000,
+		Retry:     DefaultRetry,
+		Client:    &http.Client{Timeout: time.Minute},
+	}
+}
+
+// Open resets the graphs written by the sink.
+func (s *SPARQLSink) Open() error {
+	log.Info("Loading RDF into ", s.Endpoint)
+	s.graphs = make(map[string]bool)
+	s.records = make(map[string]bool)
+	s.pages = make(map[string]*sparqlPage)
+	s.ops = nil
+	s.pending = 0
+	return nil
+}
+
+// Write queues the update of the record with the ones of its page.
+func (s *SPARQLSink) Write(r Record) error {
+	p := s.pages[r.Page]
+	if p == nil {
+		p = &sparqlPage{}
+		s.pages[r.Page] = p
+	}
+	graph := NewIRI(r.Page).String()
+
+	if !s.graphs[graph] {
+		s.graphs[graph] = true
+		p.ops = append(p.ops, "DROP SILENT GRAPH "+graph)
+	}
+
+	// a record found twice on a page would reuse its blank node labels
+	// on another operation, its statements are already there anyway
+	key := r.blankNodePrefix()
+	if s.records[key] {
+		return nil
+	}
+	s.records[key] = true
+
+	ts := r.Triples()
+	if len(ts) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("INSERT DATA { GRAPH " + graph + " {\n")
+	for _, t := range ts {
+		b.WriteString(t.String() + "\n")
+	}
+	b.WriteString("} }")
+	p.ops = append(p.ops, b.String())
+	p.statements += len(ts)
+	return nil
+}
+
+// PageDone adds the updates of the page to the batch, which is sent once
+// it holds BatchSize statements.
+func (s *SPARQLSink) PageDone(page Record) error {
+	p := s.pages[page.Page]
+	if p == nil {
+		return nil
+	}
+	delete(s.pages, page.Page)
+	s.ops = append(s.ops, p.ops...)
+	s.pending += p.statements
+	if s.pending >= s.BatchSize {
+		return s.sendBatch()
+	}
+	return nil
+}
+
+// Flush sends the queued updates, those of the pages not done yet
+// included. An update that can not be sent is written to the dead
+// letter file, it is only an error when there is none.
+func (s *SPARQLSink) Flush() error {
+	pages := make([]string, 0, len(s.pages))
+	for page := range s.pages {
+		pages = append(pages, page)
+	}
+	sort.Strings(pages)
+	for _, page := range pages {
+		s.ops = append(s.ops, s.pages[page].ops...)
+		delete(s.pages, page)
+	}
+	return s.sendBatch()
+}
+
+// sendBatch sends the updates of the batch.
+func (s *SPARQLSink) sendBatch() error {
+	if len(s.ops) == 0 {
+		return nil
+	}
+	update := strings.Join(s.ops, " ;\n")
+	ops := len(s.ops)
+	s.ops = nil
+	s.pending = 0
+
+	err := s.Retry.do("SPARQL update", log.Fields{"Endpoint": s.Endpoint}, func() (bool, time.Duration, error) {
+		return s.post(update)
+	})
+	if err == nil {
+		return nil
+	}
+	log.WithFields(log.Fields{
+		"Endpoint":   s.Endpoint,
+		"Operations": ops,
+		"Error":      err,
+	}).Error("SPARQL update failed")
+	if s.DeadLetter == "" {
+		return err
+	}
+	return s.deadLetter.write(s.DeadLetter, "failed SPARQL updates", []byte(update+" ;\n"))
+}
+
+// Close closes the dead letter file, the updates are sent on Flush.
+func (s *SPARQLSink) Close() error {
+	return s.deadLetter.close()
+}
+
+// post sends the update once. It tells whether a failed request is
+// worth retrying, and how long the service asked to wait.
+func (s *SPARQLSink) post(update string) (bool, time.Duration, error) {
+	req, err := http.NewRequest("POST", s.Endpoint, strings.NewReader(update))
+	if err != nil {
+		return false, 0, err
+	}
+	req.Header.Set("Content-Type", "application/sparql-update")
+	switch {
+	case s.Token != "":
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	case s.Username != "":
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return true, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("SPARQL update failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+		return retryable(resp.StatusCode), retryAfter(resp.Header), err
+	}
+	return false, 0, nil
+}
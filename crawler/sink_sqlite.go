@@ -0,0 +1,285 @@
+package crawler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	// registers the sqlite database/sql driver, pure Go so the binaries
+	// can be cross compiled without cgo
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	RegisterSink("sqlite", func(cw *Crawler, params map[string]string) (Sink, error) {
+		name := params["file"]
+		if name == "" {
+			name = "bioschemas_gocrawlit.db"
+		}
+		s := NewSQLiteSink(name)
+		s.crawler = cw
+		return s, nil
+	}, "file")
+}
+
+// sqliteSchema creates the tables of the SQLite sink. Every crawl has
+// its pages, those without metadata included, the entities found on them and their flattened properties,
+// so the results of several crawls can be compared. The entities
+// deduplicated across pages are stored once, on their first page, with
+// every page they were found on in entity_pages.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS crawls (
+	id          TEXT PRIMARY KEY,
+	base_url    TEXT,
+	started_at  TIMESTAMP,
+	finished_at TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS pages (
+	id         INTEGER PRIMARY KEY,
+	crawl_id   TEXT NOT NULL REFERENCES crawls(id),
+	url        TEXT NOT NULL,
+	final_url  TEXT,
+	status     INTEGER,
+	fetched_at TIMESTAMP,
+	hash       TEXT,
+	UNIQUE (crawl_id, url)
+);
+CREATE TABLE IF NOT EXISTS entities (
+	id        INTEGER PRIMARY KEY,
+	page_id   INTEGER NOT NULL REFERENCES pages(id),
+	type      TEXT,
+	entity_id TEXT,
+	extractor TEXT,
+	source    TEXT,
+	raw       TEXT
+);
+CREATE TABLE IF NOT EXISTS properties (
+	entity_id INTEGER NOT NULL REFERENCES entities(id),
+	path      TEXT NOT NULL,
+	value     TEXT
+);
+CREATE TABLE IF NOT EXISTS entity_pages (
+	entity_id INTEGER NOT NULL REFERENCES entities(id),
+	url       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS pages_url ON pages (url);
+CREATE INDEX IF NOT EXISTS entities_page ON entities (page_id);
+CREATE INDEX IF NOT EXISTS entities_type ON entities (type);
+CREATE INDEX IF NOT EXISTS properties_entity ON properties (entity_id);
+CREATE INDEX IF NOT EXISTS properties_path ON properties (path, value);
+CREATE INDEX IF NOT EXISTS entity_pages_entity ON entity_pages (entity_id);
+CREATE INDEX IF NOT EXISTS entity_pages_url ON entity_pages (url);
+`
+
+// sqliteBatch is the number of records written on each transaction.
+const sqliteBatch = 500
+
+// SQLiteSink stores the crawl results on a SQLite database. Records are
+// written in transactions of a few hundred records.
+type SQLiteSink struct {
+	FileName string
+
+	crawler *Crawler
+	db      *sql.DB
+	tx      *sql.Tx
+	n       int
+	pages   map[string]int64
+}
+
+// NewSQLiteSink creates a sink writing to the given database file.
+func NewSQLiteSink(fileName string) *SQLiteSink {
+	return &SQLiteSink{FileName: fileName}
+}
+
+// Open creates the database tables if needed and the crawl.
+func (s *SQLiteSink) Open() error {
+	db, err := sql.Open("sqlite", s.FileName)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return err
+	}
+	if err := sqliteMigrate(db); err != nil {
+		db.Close()
+		return err
+	}
+
+	var baseURL string
+	if s.crawler != nil && s.crawler.BaseURL != nil {
+		baseURL = s.crawler.BaseURL.String()
+	}
+	if _, err := db.Exec(`INSERT OR REPLACE INTO crawls (id, base_url, started_at) VALUES (?, ?, ?)`,
+		s.crawlID(), baseURL, time.Now().UTC()); err != nil {
+		db.Close()
+		return err
+	}
+
+	log.Info("Writing records to ", s.FileName, " crawl ", s.crawlID())
+	s.db = db
+	s.pages = make(map[string]int64)
+	return nil
+}
+
+// sqliteMigrate adds the columns the tables of earlier versions lack.
+func sqliteMigrate(db *sql.DB) error {
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM pragma_table_info('pages') WHERE name = 'final_url'`).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		_, err := db.Exec(`ALTER TABLE pages ADD COLUMN final_url TEXT`)
+		return err
+	}
+	return nil
+}
+
+func (s *SQLiteSink) crawlID() string {
+	if s.crawler == nil {
+		return ""
+	}
+	return s.crawler.CrawlID
+}
+
+// Write stores the page of the record, its entities and their
+// properties. A record that can not be stored is rolled back to leave no
+// partial rows in the transaction.
+func (s *SQLiteSink) Write(r Record) error {
+	if err := s.begin(); err != nil {
+		return err
+	}
+
+	if _, err := s.tx.Exec(`SAVEPOINT record`); err != nil {
+		return err
+	}
+	_, known := s.pages[r.Page]
+	if err := s.write(r); err != nil {
+		s.tx.Exec(`ROLLBACK TO record`)
+		s.tx.Exec(`RELEASE record`)
+		if !known {
+			delete(s.pages, r.Page)
+		}
+		return err
+	}
+	if _, err := s.tx.Exec(`RELEASE record`); err != nil {
+		return err
+	}
+
+	s.n++
+	if s.n >= sqliteBatch {
+		return s.Flush()
+	}
+	return nil
+}
+
+// begin starts a transaction unless one is open.
+func (s *SQLiteSink) begin() error {
+	if s.tx != nil {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	s.tx = tx
+	return nil
+}
+
+// PageDone stores the page, so the pages without records are listed.
+func (s *SQLiteSink) PageDone(page Record) error {
+	if _, ok := s.pages[page.Page]; ok {
+		return nil
+	}
+	if err := s.begin(); err != nil {
+		return err
+	}
+	_, err := s.page(page)
+	return err
+}
+
+func (s *SQLiteSink) write(r Record) error {
+	pageID, err := s.page(r)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range r.Entities() {
+		raw, err := json.Marshal(e.Data)
+		if err != nil {
+			return err
+		}
+		res, err := s.tx.Exec(`INSERT INTO entities (page_id, type, entity_id, extractor, source, raw) VALUES (?, ?, ?, ?, ?, ?)`,
+			pageID, strings.Join(e.Types, " "), e.ID, r.Extractor, r.Source, string(raw))
+		if err != nil {
+			return err
+		}
+		entityID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		for _, p := range e.Properties() {
+			if _, err := s.tx.Exec(`INSERT INTO properties (entity_id, path, value) VALUES (?, ?, ?)`, entityID, p.Path, p.Value); err != nil {
+				return err
+			}
+		}
+		for _, page := range r.Pages {
+			if _, err := s.tx.Exec(`INSERT INTO entity_pages (entity_id, url) VALUES (?, ?)`, entityID, page); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// page returns the row id of the record page, creating it the first time.
+func (s *SQLiteSink) page(r Record) (int64, error) {
+	if id, ok := s.pages[r.Page]; ok {
+		return id, nil
+	}
+
+	var fetchedAt interface{}
+	if !r.FetchedAt.IsZero() {
+		fetchedAt = r.FetchedAt
+	}
+	var finalURL interface{}
+	if r.FinalURL != "" {
+		finalURL = r.FinalURL
+	}
+	if _, err := s.tx.Exec(`INSERT OR IGNORE INTO pages (crawl_id, url, final_url, status, fetched_at, hash) VALUES (?, ?, ?, ?, ?, ?)`,
+		s.crawlID(), r.Page, finalURL, r.Status, fetchedAt, r.Hash); err != nil {
+		return 0, err
+	}
+	var id int64
+	if err := s.tx.QueryRow(`SELECT id FROM pages WHERE crawl_id = ? AND url = ?`, s.crawlID(), r.Page).Scan(&id); err != nil {
+		return 0, err
+	}
+	s.pages[r.Page] = id
+	return id, nil
+}
+
+// Flush commits the current transaction.
+func (s *SQLiteSink) Flush() error {
+	s.n = 0
+	if s.tx == nil {
+		return nil
+	}
+	err := s.tx.Commit()
+	s.tx = nil
+	return err
+}
+
+// Close records the end of the crawl and closes the database.
+func (s *SQLiteSink) Close() error {
+	if s.tx != nil {
+		s.tx.Rollback()
+	}
+	if _, err := s.db.Exec(`UPDATE crawls SET finished_at = ? WHERE id = ?`, time.Now().UTC(), s.crawlID()); err != nil {
+		s.db.Close()
+		return err
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,310 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Table output formats.
+const (
+	FormatCSV = "csv"
+	FormatTSV = "tsv"
+)
+
+// DefaultJoin separates the values of a multi-valued column.
+const DefaultJoin = " | "
+
+func init() {
+	RegisterSink("csv", func(cw *Crawler, params map[string]string) (Sink, error) {
+		format := params["format"]
+		if format == "" {
+			format = FormatCSV
+		}
+		if format != FormatCSV && format != FormatTSV {
+			return nil, fmt.Errorf("unknown table format %q, use %s or %s", format, FormatCSV, FormatTSV)
+		}
+
+		prefix, ok := params["prefix"]
+		if !ok {
+			prefix = filepath.Base(cw.outputBase()) + "_"
+		}
+		dir := params["dir"]
+		if dir == "" {
+			dir = filepath.Dir(cw.outputBase())
+		}
+
+		s := NewTableSink(dir, prefix, format)
+		var err error
+		if s.Exists, err = existsParam(params); err != nil {
+			return nil, err
+		}
+		s.Columns = SplitList(params["columns"])
+		s.Types = SplitList(params["types"])
+		if j, ok := params["join"]; ok {
+			s.Join = j
+		}
+		return s, nil
+	}, "dir", "prefix", "format", "columns", "types", "join", "exists")
+}
+
+var tableFileName = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// TableSink writes the entities found as spreadsheets, one CSV or TSV
+// file per type named <Dir>/<Prefix><type>.<format>. Every entity is a
+// row with the page it was found on, the pages a deduplicated entity was
+// found on, and its properties flattened into
+// dotted columns, e.g. creator.name, the values of a multi-valued
+// column being separated by Join. An entity with several types is
+// written to the table of each, untyped ones to the Thing table.
+//
+// Columns selects the columns of every table, page, pages and source
+// being the page, deduplicated pages and metadata document URLs. When empty the tables have every
+// property found, which is why the rows are only written on Close,
+// being kept on a temporary file meanwhile. Types restricts the tables
+// written. Exists tells what to do with the tables of an earlier crawl,
+// as for an OutputFile.
+type TableSink struct {
+	Dir     string
+	Prefix  string
+	Format  string
+	Columns []string
+	Types   []string
+	Join    string
+	Exists  string
+
+	tables map[string]*table
+	tmp    *os.File
+	w      *bufio.Writer
+	offset int64
+}
+
+// table holds the columns of a type and where its rows are on the
+// temporary file, a row being the values of each column.
+type table struct {
+	columns map[string]bool
+	rows    []spill
+}
+
+// NewTableSink creates a sink writing tables of the given format on dir.
+func NewTableSink(dir, prefix, format string) *TableSink {
+	return &TableSink{Dir: dir, Prefix: prefix, Format: format, Join: DefaultJoin, Exists: ExistsTimestamp}
+}
+
+// Open checks the output directory can be written to and creates the
+// temporary file.
+func (s *TableSink) Open() error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	// the tables are only known on Close, refuse the crawl as soon as
+	// any of an earlier one is there
+	if s.Exists == ExistsRefuse {
+		if old, _ := filepath.Glob(filepath.Join(s.Dir, s.Prefix+"*."+s.Format)); len(old) > 0 {
+			return fmt.Errorf("%s already exists", old[0])
+		}
+	}
+	tmp, err := ioutil.TempFile("", "gocrawlit-*.jsonl")
+	if err != nil {
+		return err
+	}
+	log.Info("Writing ", s.Format, " tables to ", filepath.Join(s.Dir, s.Prefix+"<type>."+s.Format))
+	s.tables = make(map[string]*table)
+	s.tmp, s.w, s.offset = tmp, bufio.NewWriter(tmp), 0
+	return nil
+}
+
+// Write spills a row for every entity of the record to the temporary
+// file.
+func (s *TableSink) Write(r Record) error {
+	for _, e := range r.Entities() {
+		row := map[string][]string{"page": {r.Page}}
+		if r.Source != "" {
+			row["source"] = []string{r.Source}
+		}
+		if len(r.Pages) > 0 {
+			row["pages"] = r.Pages
+		}
+		for _, p := range e.Properties() {
+			row[p.Path] = append(row[p.Path], p.Value)
+		}
+
+		types := e.Types
+		if len(types) == 0 {
+			types = []string{"Thing"}
+		}
+
+		var sp *spill
+		for _, t := range types {
+			if !s.exported(t) {
+				continue
+			}
+			if sp == nil {
+				b, err := json.Marshal(row)
+				if err != nil {
+					return err
+				}
+				if _, err := s.w.Write(b); err != nil {
+					return err
+				}
+				sp = &spill{offset: s.offset, size: len(b)}
+				s.offset += int64(len(b))
+			}
+
+			tb, ok := s.tables[t]
+			if !ok {
+				tb = &table{columns: map[string]bool{}}
+				s.tables[t] = tb
+			}
+			for c := range row {
+				tb.columns[c] = true
+			}
+			tb.rows = append(tb.rows, *sp)
+		}
+	}
+	return nil
+}
+
+// exported tells whether the table of a type is written.
+func (s *TableSink) exported(t string) bool {
+	if len(s.Types) == 0 {
+		return true
+	}
+	for _, st := range s.Types {
+		if shortType(st) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Flush writes the spilled rows to the temporary file, the tables are
+// written on Close.
+func (s *TableSink) Flush() error {
+	return s.w.Flush()
+}
+
+// Close writes a file for every table and removes the temporary file.
+func (s *TableSink) Close() error {
+	defer os.Remove(s.tmp.Name())
+	defer s.tmp.Close()
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+
+	types := make([]string, 0, len(s.tables))
+	for t := range s.tables {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	for _, t := range types {
+		name, err := s.writeTable(filepath.Join(s.Dir, s.Prefix+tableFileName.ReplaceAllString(t, "_")+"."+s.Format), s.tables[t])
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"Type": t,
+			"Rows": len(s.tables[t].rows),
+		}).Info("Table written to ", name)
+	}
+	return nil
+}
+
+// columns returns the columns of a table: the selected ones, or the
+// page, the source, the pages and every property sorted.
+func (s *TableSink) columns(tb *table) []string {
+	if len(s.Columns) > 0 {
+		return s.Columns
+	}
+
+	cols := []string{"page"}
+	for _, c := range []string{"source", "pages"} {
+		if tb.columns[c] {
+			cols = append(cols, c)
+		}
+	}
+	var props []string
+	for c := range tb.columns {
+		if c != "page" && c != "source" && c != "pages" {
+			props = append(props, c)
+		}
+	}
+	sort.Strings(props)
+	return append(cols, props...)
+}
+
+// tsvEscape replaces the characters a TSV value can not hold.
+var tsvEscape = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+
+// writeTable writes a table to the given file, or next to it as set by
+// Exists, and returns the name of the file written. CSV values are
+// quoted as needed, TSV ones have their tabs and newlines replaced by
+// spaces and are written as they are.
+func (s *TableSink) writeTable(name string, tb *table) (string, error) {
+	o := NewOutputFile(name)
+	o.Exists = s.Exists
+	if err := o.Open(); err != nil {
+		return "", err
+	}
+	defer o.Close()
+
+	bw := bufio.NewWriter(o)
+	w := csv.NewWriter(bw)
+	write := w.Write
+	if s.Format == FormatTSV {
+		write = func(record []string) error {
+			for i, v := range record {
+				record[i] = tsvEscape.Replace(v)
+			}
+			_, err := bw.WriteString(strings.Join(record, "\t") + "\n")
+			return err
+		}
+	}
+
+	cols := s.columns(tb)
+	if err := write(append([]string(nil), cols...)); err != nil {
+		return "", err
+	}
+	record := make([]string, len(cols))
+	for _, sp := range tb.rows {
+		row, err := s.read(sp)
+		if err != nil {
+			return "", err
+		}
+		for i, c := range cols {
+			record[i] = strings.Join(row[c], s.Join)
+		}
+		if err := write(record); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", err
+	}
+	if err := bw.Flush(); err != nil {
+		return "", err
+	}
+	return o.Name, o.Close()
+}
+
+// read reads a spilled row back.
+func (s *TableSink) read(sp spill) (map[string][]string, error) {
+	var row map[string][]string
+	b := make([]byte, sp.size)
+	if _, err := s.tmp.ReadAt(b, sp.offset); err != nil {
+		return nil, err
+	}
+	err := json.Unmarshal(b, &row)
+	return row, err
+}
@@ -0,0 +1,1208 @@
+package crawler
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type memorySink struct {
+	records []Record
+	opened  bool
+	closed  bool
+	// done holds the number of records written when each page was done
+	done map[string]int
+}
+
+func (s *memorySink) Open() error {
+	s.opened = true
+	return nil
+}
+
+func (s *memorySink) Write(r Record) error {
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *memorySink) PageDone(page Record) error {
+	if s.done == nil {
+		s.done = make(map[string]int)
+	}
+	s.done[page.Page] = len(s.records)
+	return nil
+}
+
+func (s *memorySink) Flush() error {
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestParseSinkSpec(t *testing.T) {
+	name, params, err := ParseSinkSpec("jsonl:file=out.jsonl, compress = gzip")
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if name != "jsonl" {
+		t.Errorf("Expecting sink name jsonl but got %s", name)
+	}
+	if params["file"] != "out.jsonl" || params["compress"] != "gzip" {
+		t.Errorf("Unexpected sink parameters %v", params)
+	}
+
+	if l := SplitList(" page;name , identifier;"); strings.Join(l, "|") != "page|name|identifier" {
+		t.Errorf("Unexpected list %v", l)
+	}
+
+	if _, _, err := ParseSinkSpec("jsonl:file"); err == nil {
+		t.Errorf("Expecting an error for a parameter without value")
+	}
+
+	_, err = NewSink("webhook", &Crawler{}, map[string]string{"url": "http://example.com/", "retires": "5"})
+	if err == nil || !strings.Contains(err.Error(), "retires") {
+		t.Errorf("Expecting an error for a misspelt parameter, got %v", err)
+	}
+	if _, err := NewSink("webhook", &Crawler{}, map[string]string{"url": "http://example.com/", "batch": "0"}); err == nil {
+		t.Errorf("Expecting an error for an empty batch")
+	}
+}
+
+func TestRegisterSink(t *testing.T) {
+	m := &memorySink{}
+	RegisterSink("memory", func(cw *Crawler, params map[string]string) (Sink, error) {
+		return m, nil
+	})
+	// the factories are global, other tests must not see this one
+	defer func() {
+		sinksMu.Lock()
+		delete(sinkFactories, "memory")
+		sinksMu.Unlock()
+	}()
+
+	cw := &Crawler{}
+	s, err := NewSink("memory", cw, nil)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	other := &memorySink{}
+	cw.AddSink(s)
+	cw.AddSink(other)
+
+	cw.openSinks()
+	cw.emit(Record{Page: "http://example.com/", Metadata: map[string]interface{}{"@type": "Dataset"}})
+	cw.Close()
+	cw.emit(Record{Page: "http://example.com/", Metadata: map[string]interface{}{"@type": "Dataset"}})
+
+	if !m.opened || !m.closed {
+		t.Errorf("Expecting sink to be opened and closed")
+	}
+	for _, s := range []*memorySink{m, other} {
+		if len(s.records) != 1 {
+			t.Errorf("Expecting every sink to get 1 record before being closed but got %d", len(s.records))
+		}
+	}
+
+	if _, err := NewSink("nope", cw, nil); err == nil {
+		t.Errorf("Expecting an error for an unknown sink")
+	}
+}
+
+// failingSink is a sink that can not be opened.
+type failingSink struct {
+	memorySink
+}
+
+func (s *failingSink) Open() error {
+	return fmt.Errorf("service unavailable")
+}
+
+func TestOpenSinksFailure(t *testing.T) {
+	m := &memorySink{}
+	cw := &Crawler{}
+	cw.AddSink(m)
+	cw.AddSink(&failingSink{})
+
+	if err := cw.Start(); err == nil || !strings.Contains(err.Error(), "service unavailable") {
+		t.Fatalf("Expecting the crawl not to start when a sink can not be opened, got %v", err)
+	}
+	if !m.opened || !m.closed {
+		t.Errorf("Expecting the sinks already opened to be closed")
+	}
+	if len(cw.Sinks) != 0 {
+		t.Errorf("Expecting no sink left, got %v", cw.Sinks)
+	}
+}
+
+func TestRecordEnvelope(t *testing.T) {
+	r := Record{
+		CrawlID:   "20180601T100000Z",
+		Page:      "http://example.com/",
+		FinalURL:  "https://example.com/",
+		Source:    "http://example.com/meta.jsonld",
+		Extractor: ExtractorJSONLD,
+		Block:     1,
+		Status:    200,
+		FetchedAt: time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC),
+		Hash:      "da39a3ee5e6b4b0d3255bfef95601890afd80709",
+		Metadata:  map[string]interface{}{"name": "A"},
+	}
+
+	j, err := json.Marshal(r.Envelope())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"version":1,"crawl_id":"20180601T100000Z","page":"http://example.com/","final_url":"https://example.com/","status":200,"fetched_at":"2018-06-01T10:00:00Z","content_hash":"da39a3ee5e6b4b0d3255bfef95601890afd80709","extractor":"json-ld","block":1,"source":"http://example.com/meta.jsonld","data":{"name":"A"}}`
+	if string(j) != expected {
+		t.Errorf("Expecting %s but got %s", expected, j)
+	}
+	if len(r.Metadata) != 1 {
+		t.Errorf("Expecting record metadata not to be modified")
+	}
+
+	j, _ = json.Marshal(Record{Page: "http://example.com/"}.Envelope())
+	if string(j) != `{"version":1,"page":"http://example.com/","block":0,"data":{}}` {
+		t.Errorf("Unexpected envelope %s", j)
+	}
+}
+
+func TestEnvelopeTriplesRoundTrip(t *testing.T) {
+	r := Record{Page: "http://example.com/", Extractor: ExtractorRDFa, Metadata: map[string]interface{}{"triples": []Triple{
+		{NewIRI("http://example.com/ds"), NewIRI(rdfType), NewIRI(schemaOrgVocab + "Dataset")},
+		{NewIRI("http://example.com/ds"), NewIRI(schemaOrgVocab + "name"), NewLiteral("Genes", "", "en")},
+	}}}
+
+	var buf bytes.Buffer
+	j, _ := json.Marshal(r.Envelope())
+	buf.Write(append(j, '\n'))
+	var read []Record
+	if err := ReadJSONL(&buf, func(r Record) error {
+		read = append(read, r)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(read) != 1 {
+		t.Fatalf("Expecting 1 record but got %d", len(read))
+	}
+	es := read[0].Entities()
+	if len(es) != 1 || es[0].Type() != "Dataset" || es[0].Data["name"] != "Genes" {
+		t.Errorf("Expecting the Dataset back but got %v", es)
+	}
+	if ts := read[0].Triples(); len(ts) != 2 || ts[1].Object.Language != "en" {
+		t.Errorf("Expecting the triples back but got %v", ts)
+	}
+}
+
+func TestReadJSONLFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, c := range []string{CompressGzip, CompressZstd} {
+		s := NewJSONLSink(filepath.Join(dir, c+".jsonl"))
+		s.Output.Compress = c
+		s.Output.MaxRecords = 2
+		if err := s.Open(); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"A", "B", "C"} {
+			s.Write(Record{Page: "http://example.com/", Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"@type": "Dataset", "name": name}})
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		ext := compressExt[c]
+		var names []string
+		if err := ReadJSONLFiles([]string{filepath.Join(dir, c+".jsonl"+ext), filepath.Join(dir, c+".1.jsonl"+ext)}, func(r Record) error {
+			names = append(names, r.Metadata["name"].(string))
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(names, "") != "ABC" {
+			t.Errorf("Expecting the records of both %s parts but got %v", c, names)
+		}
+	}
+}
+
+func TestSPARQLSink(t *testing.T) {
+	var updates []string
+	failures := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/sparql-update" {
+			t.Errorf("Unexpected content type %s", r.Header.Get("Content-Type"))
+		}
+		if u, p, ok := r.BasicAuth(); !ok || u != "crawler" || p != "secret" {
+			t.Errorf("Expecting basic auth credentials")
+		}
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		updates = append(updates, string(b))
+	}))
+	defer srv.Close()
+
+	s := NewSPARQLSink(srv.URL)
+	s.Username, s.Password = "crawler", "secret"
+	s.RetryWait = time.Millisecond
+	s.Open()
+
+	page := "http://example.com/page"
+	triples := func(name string) Record {
+		return Record{Page: page, Extractor: ExtractorRDF, Metadata: map[string]interface{}{
+			"triples": []Triple{{NewIRI("http://example.com/ds1"), NewIRI(schemaOrgVocab + "name"), NewLiteral(name, "", "")}},
+		}}
+	}
+	s.Write(triples("Proteins"))
+	s.Write(triples("Proteins"))
+	s.Write(triples("Genes"))
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	if len(updates) != 1 {
+		t.Fatalf("Expecting 1 update request but got %d", len(updates))
+	}
+	u := updates[0]
+	if !strings.HasPrefix(u, "DROP SILENT GRAPH <"+page+"> ;\nINSERT DATA { GRAPH <"+page+"> {") {
+		t.Errorf("Expecting the page graph to be dropped and inserted, got %s", u)
+	}
+	if strings.Count(u, "DROP") != 1 || strings.Count(u, "INSERT DATA") != 2 {
+		t.Errorf("Expecting one drop and two inserts, got %s", u)
+	}
+
+	// a full batch waits for the end of the page, the records of a page
+	// may come after those of the pages it links to
+	s.BatchSize = 1
+	late := triples("Enzymes")
+	late.Page = "http://example.com/late"
+	s.Write(late)
+	child := triples("Cells")
+	child.Page = "http://example.com/child"
+	s.Write(child)
+	if len(updates) != 1 {
+		t.Errorf("Expecting no request in the middle of a page, got %v", updates)
+	}
+	s.PageDone(Record{Page: child.Page})
+	if len(updates) != 2 || !strings.Contains(updates[1], "GRAPH <"+child.Page+">") || strings.Contains(updates[1], late.Page) {
+		t.Errorf("Expecting the done page alone in a batch, got %v", updates)
+	}
+	late.Metadata = triples("Lipids").Metadata
+	s.Write(late)
+	s.PageDone(Record{Page: late.Page})
+	if len(updates) != 3 || strings.Count(updates[2], "DROP SILENT GRAPH <"+late.Page+">") != 1 || strings.Count(updates[2], "INSERT DATA") != 2 {
+		t.Errorf("Expecting the drop and both inserts of the late page in a batch, got %v", updates)
+	}
+
+	// updates rejected go to the dead letter file, with those of the
+	// pages not done yet
+	other := triples("Cells")
+	other.Page = "http://example.com/other"
+	s.Write(other)
+	dir, err := ioutil.TempDir("", "sparql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s.DeadLetter = filepath.Join(dir, "failed.ru")
+	failures = 10
+	s.Retries = 0
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Expecting the failed update to be dead lettered, got %s", err)
+	}
+	s.Close()
+	b, _ := ioutil.ReadFile(s.DeadLetter)
+	if !strings.HasPrefix(string(b), "DROP SILENT GRAPH <http://example.com/other> ;\nINSERT DATA") || !strings.HasSuffix(string(b), "} } ;\n") {
+		t.Errorf("Unexpected dead letter file %s", b)
+	}
+}
+
+func TestSQLiteSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocrawlit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewSQLiteSink(filepath.Join(dir, "crawl.db"))
+	s.crawler = &Crawler{CrawlID: "crawl1"}
+	if err := s.Open(); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	page := "http://example.com/page"
+	s.Write(Record{Page: page, Extractor: ExtractorJSONLD, Status: 200, Hash: "abc", Metadata: map[string]interface{}{
+		"@context": "http://schema.org",
+		"@type":    "Dataset",
+		"@id":      "http://example.com/ds1",
+		"name":     "Proteins",
+		"keywords": []interface{}{"a", "b"},
+		"creator":  map[string]interface{}{"@type": "Person", "name": "Jane"},
+	}})
+	s.Write(Record{Page: page, Extractor: ExtractorSignposting, Metadata: map[string]interface{}{"signposting": nil}})
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	var pages, entities int
+	s.db.QueryRow(`SELECT count(*) FROM pages WHERE crawl_id = 'crawl1' AND status = 200 AND hash = 'abc'`).Scan(&pages)
+	s.db.QueryRow(`SELECT count(*) FROM entities WHERE type = 'Dataset' AND entity_id = 'http://example.com/ds1' AND extractor = 'json-ld'`).Scan(&entities)
+	if pages != 1 || entities != 1 {
+		t.Errorf("Expecting 1 page and 1 entity but got %d and %d", pages, entities)
+	}
+
+	rows, err := s.db.Query(`SELECT path, value FROM properties ORDER BY path, value`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var props []string
+	for rows.Next() {
+		var p, v string
+		rows.Scan(&p, &v)
+		props = append(props, p+"="+v)
+	}
+	rows.Close()
+	expected := "@id=http://example.com/ds1 creator.@type=Person creator.name=Jane keywords=a keywords=b name=Proteins"
+	if strings.Join(props, " ") != expected {
+		t.Errorf("Expecting properties %s but got %s", expected, strings.Join(props, " "))
+	}
+
+	// a record failing halfway leaves nothing behind
+	if _, err := s.db.Exec(`CREATE TRIGGER boom BEFORE INSERT ON properties WHEN NEW.value = 'boom' BEGIN SELECT RAISE(ABORT, 'boom'); END`); err != nil {
+		t.Fatal(err)
+	}
+	broken := "http://example.com/broken"
+	if err := s.Write(Record{Page: broken, Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"@type": "Dataset", "name": "boom"}}); err == nil {
+		t.Errorf("Expecting the failing record to be an error")
+	}
+	s.Write(Record{Page: page, Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"@type": "Event", "name": "Course"}})
+	s.Flush()
+	s.db.QueryRow(`SELECT count(*) FROM pages WHERE url = ?`, broken).Scan(&pages)
+	s.db.QueryRow(`SELECT count(*) FROM entities`).Scan(&entities)
+	if pages != 0 || entities != 2 {
+		t.Errorf("Expecting the failing record rolled back but got %d pages and %d entities", pages, entities)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Errorf("Expected no error but got %s", err)
+	}
+}
+
+func TestSQLiteSinkPages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocrawlit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "crawl.db")
+
+	// a database of an earlier version, without the final URLs
+	db, err := sql.Open("sqlite", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE pages (id INTEGER PRIMARY KEY, crawl_id TEXT NOT NULL, url TEXT NOT NULL, status INTEGER, fetched_at TIMESTAMP, hash TEXT, UNIQUE (crawl_id, url))`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	site := newTestSite(map[string]http.HandlerFunc{
+		"/": serveHTML(`<html><body><a href="/old">Old</a><a href="/dataset">Dataset</a></body></html>`),
+		"/old": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/empty", http.StatusMovedPermanently)
+		},
+		"/empty":   serveHTML(`<html><body>Nothing here</body></html>`),
+		"/dataset": serveHTML(`<html><body><script type="application/ld+json">{"@context":"http://schema.org","@type":"Dataset","name":"Genes"}</script></body></html>`),
+	})
+	defer site.Close()
+
+	site.crawl(t, "/", func(cw *Crawler) {
+		cw.CrawlID = "crawl1"
+		s, err := NewSink("sqlite", cw, map[string]string{"file": name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cw.AddSink(s)
+	})
+
+	db, err = sql.Open("sqlite", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT url, coalesce(final_url, ''), status, hash, (SELECT count(*) FROM entities WHERE page_id = pages.id) FROM pages WHERE crawl_id = 'crawl1' ORDER BY url`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var pages []string
+	for rows.Next() {
+		var url, finalURL, hash string
+		var status, entities int
+		if err := rows.Scan(&url, &finalURL, &status, &hash, &entities); err != nil {
+			t.Fatal(err)
+		}
+		if status != 200 || hash == "" {
+			t.Errorf("Expecting the status and hash of %s, got %d %q", url, status, hash)
+		}
+		pages = append(pages, fmt.Sprintf("%s %s %d", strings.TrimPrefix(url, site.URL), strings.TrimPrefix(finalURL, site.URL), entities))
+	}
+	if expected := "/ / 0|/dataset /dataset 1|/old /empty 0"; strings.Join(pages, "|") != expected {
+		t.Errorf("Expecting every page fetched %s but got %s", expected, strings.Join(pages, "|"))
+	}
+}
+
+func TestElasticSink(t *testing.T) {
+	var bulk []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "ApiKey secret" {
+			t.Errorf("Expecting API key authorization")
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/":
+			fmt.Fprint(w, `{"version":{"number":"6.8.0"}}`)
+		case r.Method == "HEAD" && r.URL.Path == "/biosamples":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "PUT" && r.URL.Path == "/_template/gocrawlit-biosamples":
+			if !strings.Contains(readAll(r), `"mappings":{"_doc":{"dynamic_templates"`) {
+				t.Errorf("Expecting an Elasticsearch 6 legacy template")
+			}
+		case r.Method == "PUT" && (r.URL.Path == "/biosamples" || r.URL.Path == "/biosamples/_mapping/_doc"):
+			fmt.Fprint(w, `{"acknowledged":true}`)
+		case r.Method == "POST" && r.URL.Path == "/_bulk":
+			b, _ := ioutil.ReadAll(r.Body)
+			bulk = append(bulk, string(b))
+			fmt.Fprint(w, `{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}}]}`)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "elastic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewElasticSink(srv.URL, "biosamples")
+	s.APIKey = "secret"
+	s.BatchSize = 2
+	s.DeadLetter = filepath.Join(dir, "failed.ndjson")
+	if err := s.Open(); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	for _, name := range []string{"A", "B"} {
+		s.Write(Record{Page: "http://example.com/", Metadata: map[string]interface{}{"name": name}})
+	}
+	if err := s.Flush(); err == nil {
+		t.Errorf("Expecting an error for the rejected document")
+	}
+	s.Close()
+
+	if len(bulk) != 1 {
+		t.Fatalf("Expecting 1 bulk request but got %d", len(bulk))
+	}
+	if !strings.HasPrefix(bulk[0], `{"index":{"_id":"`) || !strings.Contains(bulk[0], `"_index":"biosamples","_type":"_doc"}}`) {
+		t.Errorf("Expecting Elasticsearch 6 actions with a mapping type, got %s", bulk[0])
+	}
+	if s.Indexed() != 1 || s.Failed() != 1 {
+		t.Errorf("Expecting 1 document indexed and 1 failed but got %d and %d", s.Indexed(), s.Failed())
+	}
+	b, _ := ioutil.ReadFile(s.DeadLetter)
+	if lines := strings.Split(strings.TrimSpace(string(b)), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], `{"index":`) || !strings.Contains(lines[1], `"data":{"name":"B"}`) {
+		t.Errorf("Expecting the action and document of the rejected one in the dead letter file, got %s", b)
+	}
+}
+
+func TestElasticSinkMappingType(t *testing.T) {
+	var bulk, mapping string
+	types := `{"page":{"properties":{}}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/":
+			fmt.Fprint(w, `{"version":{"number":"6.8.0"}}`)
+		case r.Method == "HEAD" && r.URL.Path == "/bioschemas":
+		case r.Method == "GET" && r.URL.Path == "/bioschemas/_mapping":
+			fmt.Fprintf(w, `{"bioschemas":{"mappings":%s}}`, types)
+		case r.Method == "PUT" && r.URL.Path == "/_template/gocrawlit-bioschemas":
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/bioschemas/_mapping/"):
+			mapping = r.URL.Path
+		case r.Method == "POST" && r.URL.Path == "/_bulk":
+			bulk = readAll(r)
+			fmt.Fprint(w, `{"errors":false,"items":[{"index":{"status":201}}]}`)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	// the index of the crawler v1 has the page mapping type
+	s := NewElasticSink(srv.URL, "bioschemas")
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	s.Write(Record{Page: "http://example.com/", Metadata: map[string]interface{}{"name": "A"}})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if mapping != "/bioschemas/_mapping/page" || !strings.Contains(bulk, `"_type":"page"`) {
+		t.Errorf("Expecting the documents written with the page mapping type, got %s %s", mapping, bulk)
+	}
+
+	types = `{"page":{},"dataset":{}}`
+	if err := NewElasticSink(srv.URL, "bioschemas").Open(); err == nil || !strings.Contains(err.Error(), "dataset, page") {
+		t.Errorf("Expecting an error for an index with several mapping types, got %v", err)
+	}
+}
+
+func TestElasticSinkCleanup(t *testing.T) {
+	var ids []string
+	var cleanup string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/":
+			fmt.Fprint(w, `{"version":{"number":"8.11.0"}}`)
+		case r.Method == "POST" && r.URL.Path == "/_bulk":
+			lines := strings.Split(strings.TrimSpace(readAll(r)), "\n")
+			for i := 0; i < len(lines); i += 2 {
+				var action map[string]map[string]string
+				json.Unmarshal([]byte(lines[i]), &action)
+				ids = append(ids, action["index"]["_id"])
+				if !strings.Contains(lines[i+1], `"crawl_id":"crawl2"`) {
+					t.Errorf("Expecting the crawl_id on the document, got %s", lines[i+1])
+				}
+			}
+			fmt.Fprint(w, `{"errors":false,"items":[{"index":{"status":201}},{"index":{"status":201}},{"index":{"status":201}}]}`)
+		case r.URL.Path == "/biosamples/_delete_by_query":
+			cleanup = readAll(r)
+			fmt.Fprint(w, `{"deleted":3}`)
+		}
+	}))
+	defer srv.Close()
+
+	base, _ := url.Parse("http://example.com/samples")
+	cw := &Crawler{BaseURL: base, CrawlID: "crawl2", completed: 1}
+	s := NewElasticSink(srv.URL, "biosamples")
+	s.crawler = cw
+	s.Stale = StaleDelete
+	if err := s.Open(); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	page := "http://example.com/samples/1"
+	dataset := map[string]interface{}{"@type": "Dataset", "@id": "http://example.com/ds1"}
+	person := map[string]interface{}{"@type": "Person"}
+	s.Write(Record{CrawlID: "crawl2", Page: page, Extractor: ExtractorJSONLD, Metadata: dataset})
+	s.Write(Record{CrawlID: "crawl2", Page: page, Extractor: ExtractorJSONLD, Metadata: person})
+	s.Write(Record{CrawlID: "crawl2", Page: page, Extractor: ExtractorJSONLD, Metadata: person})
+	s.Flush()
+	if err := s.Close(); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	if len(ids) != 3 || ids[0] == ids[1] || ids[1] == ids[2] {
+		t.Errorf("Expecting 3 different document IDs but got %v", ids)
+	}
+	again := NewElasticSink(srv.URL, "biosamples")
+	again.ordinals = make(map[string]int)
+	if again.documentID(Record{Page: page, Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"@type": "Dataset", "@id": "http://example.com/ds1", "name": "changed"}}) != ids[0] {
+		t.Errorf("Expecting the same document ID for the same entity")
+	}
+
+	if !strings.Contains(cleanup, `"must_not":{"term":{"crawl_id":"crawl2"}}`) || !strings.Contains(cleanup, `"seed":"http://example.com/samples"`) {
+		t.Errorf("Unexpected cleanup query %s", cleanup)
+	}
+
+	// a page that failed with a server error keeps its documents
+	cleanup = ""
+	failed := &Crawler{BaseURL: base, CrawlID: "crawl3", completed: 1, fetchErrors: 1}
+	s = NewElasticSink(srv.URL, "biosamples")
+	s.crawler = failed
+	s.Stale = StaleDelete
+	if err := s.Open(); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if cleanup != "" {
+		t.Errorf("Expecting no cleanup after fetch errors but got %s", cleanup)
+	}
+}
+
+func readAll(r *http.Request) string {
+	b, _ := ioutil.ReadAll(r.Body)
+	return string(b)
+}
+
+func TestElasticDocument(t *testing.T) {
+	var doc1, doc2 map[string]interface{}
+	json.Unmarshal([]byte(`{"@context":"http://schema.org","@type":"Dataset","name":"Proteins","author":"Jane","size":12,"url":"http://example.com/ds1"}`), &doc1)
+	json.Unmarshal([]byte(`{"@context":{"@vocab":"http://schema.org/"},"@type":["Dataset"],"name":{"@value":"Genes","@language":"en"},"author":[{"@type":"Person","name":"John","@id":"http://example.com/john"}],"size":"12 MB"}`), &doc2)
+
+	d1 := elasticDocument(Record{Page: "http://example.com/1", Extractor: ExtractorJSONLD, Metadata: doc1})
+	d2 := elasticDocument(Record{Page: "http://example.com/2", Extractor: ExtractorJSONLD, Metadata: doc2})
+
+	j1, _ := json.Marshal(d1)
+	expected := `{"block":0,"data":{"@type":["Dataset"],"author":[{"@value":"Jane"}],"name":["Proteins"],"size":[{"@value":"12"}],"url":[{"@id":"http://example.com/ds1"}]},"extractor":"json-ld","page":"http://example.com/1","version":1}`
+	if string(j1) != expected {
+		t.Errorf("Expecting %s but got %s", expected, j1)
+	}
+
+	j2, _ := json.Marshal(d2)
+	expected = `{"block":0,"data":{"@type":["Dataset"],"author":[{"@id":"http://example.com/john","@type":["Person"],"name":["John"]}],"name":["Genes"],"size":[{"@value":"12 MB"}]},"extractor":"json-ld","page":"http://example.com/2","version":1}`
+	if string(j2) != expected {
+		t.Errorf("Expecting %s but got %s", expected, j2)
+	}
+}
+
+func TestResolveIndexName(t *testing.T) {
+	date := time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC)
+	if n := resolveIndexName("bioschemas-{host}-{date}-{crawl}", "Example.com:8080", "20180601T100000Z", date); n != "bioschemas-example.com-8080-2018.06.01-20180601t100000z" {
+		t.Errorf("Unexpected index name %s", n)
+	}
+	if p := indexPattern("bioschemas-{host}-{date}", "example.com"); p != "bioschemas-example.com-*" {
+		t.Errorf("Unexpected index pattern %s", p)
+	}
+
+	m := indexMatcher("bioschemas-{host}-{date}-{crawl}", "localhost")
+	for name, matches := range map[string]bool{
+		"bioschemas-localhost-2018.06.01-20180601t100000z":      true,
+		"bioschemas-localhost-8080-2018.06.01-20180601t100000z": false,
+		"bioschemas-localhost-2018.06.01-c1-old":                false,
+	} {
+		if m.MatchString(name) != matches {
+			t.Errorf("Expecting %s to match the indices of localhost: %v", name, matches)
+		}
+	}
+}
+
+func TestElasticSinkAliasAndRetention(t *testing.T) {
+	var aliases string
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/":
+			fmt.Fprint(w, `{"version":{"number":"7.17.0"}}`)
+		case r.Method == "GET" && r.URL.Path == "/_alias/bioschemas-current":
+			fmt.Fprint(w, `{"bioschemas-example.com-c1":{"aliases":{}},"bioschemas-other.org-c1":{"aliases":{}},"bioschemas-example.com-8080-c1":{"aliases":{}}}`)
+		case r.Method == "POST" && r.URL.Path == "/_aliases":
+			aliases = readAll(r)
+		case r.Method == "GET" && r.URL.Path == "/_cat/indices/bioschemas-example.com-*":
+			fmt.Fprint(w, `[{"index":"bioschemas-example.com-c1","creation.date":"100"},{"index":"bioschemas-example.com-c0","creation.date":"50"},{"index":"bioschemas-example.com-c2","creation.date":"200"},{"index":"bioschemas-example.com-8080-c0","creation.date":"10"}]`)
+		case r.Method == "DELETE":
+			deleted = append(deleted, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	base, _ := url.Parse("http://example.com/")
+	cw := &Crawler{BaseURL: base, CrawlID: "C2", completed: 1}
+	s := NewElasticSink(srv.URL, "bioschemas-{host}-{crawl}")
+	s.crawler = cw
+	s.Alias = "bioschemas-current"
+	s.Keep = 2
+	if err := s.Open(); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if s.index != "bioschemas-example.com-c2" {
+		t.Errorf("Unexpected index %s", s.index)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	expected := `{"actions":[{"add":{"alias":"bioschemas-current","index":"bioschemas-example.com-c2"}},{"remove":{"alias":"bioschemas-current","index":"bioschemas-example.com-c1"}}]}`
+	if aliases != expected {
+		t.Errorf("Expecting alias actions %s but got %s", expected, aliases)
+	}
+	if len(deleted) != 1 || deleted[0] != "/bioschemas-example.com-c0" {
+		t.Errorf("Expecting the oldest index to be deleted but got %v", deleted)
+	}
+}
+
+func TestBleveSinkSearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocrawlit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "search.bleve")
+	s := NewBleveSink(path)
+	if err := s.Open(); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	s.Write(Record{Page: "http://example.com/1", Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{
+		"@type": "Dataset", "@id": "http://example.com/ds1", "name": "Human proteins",
+		"creator": map[string]interface{}{"@type": "Person", "name": "Jane Doe"},
+	}})
+	s.Write(Record{Page: "http://example.com/2", Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{
+		"@type": "Course", "name": "Proteins for beginners",
+	}})
+	s.Flush()
+	s.Close()
+
+	res, total, err := Search(path, SearchQuery{Text: "proteins"})
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if total != 2 {
+		t.Errorf("Expecting 2 entities for free text but got %d", total)
+	}
+
+	res, total, _ = Search(path, SearchQuery{Text: "proteins", Types: []string{"http://schema.org/Dataset"}, Properties: map[string]string{"creator.name": "jane doe"}})
+	if total != 1 || res[0].Page != "http://example.com/1" || res[0].ID != "http://example.com/ds1" || res[0].Data["name"] != "Human proteins" {
+		t.Errorf("Expecting the dataset but got %v", res)
+	}
+
+	if _, total, _ = Search(path, SearchQuery{Types: []string{"Person"}}); total != 0 {
+		t.Errorf("Expecting no top level Person entity but got %d", total)
+	}
+}
+
+func TestTableSinkFromJSONL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var ds1, ds2 map[string]interface{}
+	json.Unmarshal([]byte(`{"@context":"http://schema.org","@type":"Dataset","name":"Proteins","keywords":["protein","structure"],"creator":{"@type":"Person","name":"Jane"}}`), &ds1)
+	json.Unmarshal([]byte(`{"@context":"http://schema.org","@graph":[{"@type":"Dataset","name":"Genes","license":"CC0"},{"@type":"DataCatalog","name":"Catalog"}]}`), &ds2)
+
+	out := filepath.Join(dir, "out.jsonl")
+	js := NewJSONLSink(out)
+	if err := js.Open(); err != nil {
+		t.Fatal(err)
+	}
+	js.Write(Record{Page: "http://example.com/1", Extractor: ExtractorJSONLD, Metadata: ds1})
+	js.Write(Record{Page: "http://example.com/2", Extractor: ExtractorJSONLD, Metadata: ds2})
+	js.Close()
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s := NewTableSink(dir, "out_", FormatCSV)
+	s.Types = []string{"http://schema.org/Dataset"}
+	s.Columns = []string{"page", "name", "keywords", "creator.name"}
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadJSONL(f, s.Write); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "out_Dataset.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "page,name,keywords,creator.name\nhttp://example.com/1,Proteins,protein | structure,Jane\nhttp://example.com/2,Genes,,\n"
+	if string(b) != expected {
+		t.Errorf("Expecting %q but got %q", expected, b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out_DataCatalog.csv")); err == nil {
+		t.Errorf("Expecting no table for DataCatalog")
+	}
+
+	s = NewTableSink(dir, "all_", FormatTSV)
+	s.Open()
+	s.Write(Record{Page: "http://example.com/2", Extractor: ExtractorJSONLD, Metadata: ds2})
+	s.Write(Record{Page: "http://example.com/3", Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{
+		"@context": "http://schema.org",
+		"name":     "The \"Genes\"\tcatalog",
+	}})
+	s.Close()
+
+	b, _ = ioutil.ReadFile(filepath.Join(dir, "all_Dataset.tsv"))
+	if expected := "page\tlicense\tname\nhttp://example.com/2\tCC0\tGenes\n"; string(b) != expected {
+		t.Errorf("Expecting %q but got %q", expected, b)
+	}
+	// untyped entities, with their quotes left as they are
+	b, _ = ioutil.ReadFile(filepath.Join(dir, "all_Thing.tsv"))
+	if expected := "page\tname\nhttp://example.com/3\tThe \"Genes\" catalog\n"; string(b) != expected {
+		t.Errorf("Expecting %q but got %q", expected, b)
+	}
+}
+
+func TestTableSinkRerun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cw := &Crawler{OutputFileName: filepath.Join(dir, "out.jsonl")}
+	crawl := func(name, exists string) error {
+		s, err := NewSink("csv", cw, map[string]string{"exists": exists})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Open(); err != nil {
+			return err
+		}
+		s.Write(Record{Page: "http://example.com/", Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"@type": "Dataset", "name": name}})
+		return s.Close()
+	}
+
+	table := filepath.Join(dir, "out_Dataset.csv")
+	crawl("first", "")
+	if err := crawl("second", ""); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(table); !strings.Contains(string(b), "first") {
+		t.Errorf("Expecting the table of the first crawl to be kept, got %q", b)
+	}
+	if tables, _ := filepath.Glob(filepath.Join(dir, "out_Dataset.*.csv")); len(tables) != 1 {
+		t.Errorf("Expecting a timestamped table but got %v", tables)
+	}
+	if err := crawl("third", ExistsRefuse); err == nil {
+		t.Errorf("Expecting an error for existing tables")
+	}
+	if err := crawl("fourth", ExistsOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(table); !strings.Contains(string(b), "fourth") {
+		t.Errorf("Expecting the table to be overwritten, got %q", b)
+	}
+}
+
+func TestParquetSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var ds map[string]interface{}
+	json.Unmarshal([]byte(`{"@context":"http://schema.org","@type":"Dataset","@id":"http://example.com/ds1","name":"Proteins","keywords":["protein","structure"]}`), &ds)
+
+	s := NewParquetSink(filepath.Join(dir, "out.parquet"), filepath.Join(dir, "props.parquet"))
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	fetched := time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC)
+	if err := s.Write(Record{CrawlID: "c1", Page: "http://example.com/1", Extractor: ExtractorJSONLD, Status: 200, FetchedAt: fetched, Metadata: ds}); err != nil {
+		t.Fatal(err)
+	}
+	s.Write(Record{Page: "http://example.com/1", Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"diagnostic": "error"}})
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entities, err := parquet.ReadFile[parquetEntity](filepath.Join(dir, "out.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entities) != 1 {
+		t.Fatalf("Expecting 1 entity but got %d", len(entities))
+	}
+	e := entities[0]
+	if e.Type != "Dataset" || e.ID != "http://example.com/ds1" || e.Page != "http://example.com/1" || e.Status != 200 || !e.FetchedAt.Equal(fetched) || e.Version != EnvelopeVersion {
+		t.Errorf("Unexpected entity row %+v", e)
+	}
+	if expected := `{"@id":"http://example.com/ds1","@type":"Dataset","keywords":["protein","structure"],"name":"Proteins"}`; e.Data != expected {
+		t.Errorf("Expecting %s but got %s", expected, e.Data)
+	}
+
+	props, err := parquet.ReadFile[parquetProperty](filepath.Join(dir, "props.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range props {
+		if p.Entity != e.Entity {
+			t.Errorf("Expecting property of entity %s, got %s", e.Entity, p.Entity)
+		}
+		got = append(got, fmt.Sprintf("%s[%d]=%s", p.Path, p.Position, p.Value))
+	}
+	if expected := "@id[0]=http://example.com/ds1 keywords[0]=protein keywords[1]=structure name[0]=Proteins"; strings.Join(got, " ") != expected {
+		t.Errorf("Expecting %s but got %s", expected, strings.Join(got, " "))
+	}
+}
+
+func TestParquetSinkNegotiated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	site := newTestSite(map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			switch accept := r.Header.Get("Accept"); {
+			case strings.HasPrefix(accept, "text/turtle"):
+				w.Header().Set("Content-Type", "text/turtle")
+				fmt.Fprint(w, `<http://example.com/ds> a <http://schema.org/Dataset> ; <http://schema.org/name> "Genes" .`)
+			case strings.HasPrefix(accept, "application/n-triples"):
+				w.Header().Set("Content-Type", "application/n-triples")
+				fmt.Fprint(w, `<http://example.com/ds> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://schema.org/Dataset> .
+<http://example.com/ds> <http://schema.org/name> "Proteins" .
+`)
+			default:
+				serveHTML(`<html><head><title>Genes</title></head><body></body></html>`)(w, r)
+			}
+		},
+	})
+	defer site.Close()
+
+	site.crawl(t, "/", func(cw *Crawler) {
+		cw.Negotiate = true
+		cw.AddSink(NewParquetSink(filepath.Join(dir, "out.parquet"), filepath.Join(dir, "props.parquet")))
+	})
+
+	entities, err := parquet.ReadFile[parquetEntity](filepath.Join(dir, "out.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entities) != 2 || entities[0].Entity == entities[1].Entity {
+		t.Fatalf("Expecting an entity with its own key for every representation but got %+v", entities)
+	}
+	props, err := parquet.ReadFile[parquetProperty](filepath.Join(dir, "props.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]string)
+	for _, p := range props {
+		if p.Path == "name" {
+			names[p.Entity] += p.Value
+		}
+	}
+	for _, e := range entities {
+		if !strings.Contains(e.Data, names[e.Entity]) || names[e.Entity] == "" {
+			t.Errorf("Expecting the name of entity %s, got %q for %s", e.Entity, names[e.Entity], e.Data)
+		}
+	}
+}
+
+func TestParquetSinkRerun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cw := &Crawler{OutputFileName: filepath.Join(dir, "out.jsonl")}
+	crawl := func(name, exists string) error {
+		s, err := NewSink("parquet", cw, map[string]string{"exists": exists})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Open(); err != nil {
+			return err
+		}
+		s.Write(Record{Page: "http://example.com/", Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"@type": "Dataset", "name": name}})
+		return s.Close()
+	}
+
+	crawl("first", "")
+	if err := crawl("second", ""); err != nil {
+		t.Fatal(err)
+	}
+	entities, err := parquet.ReadFile[parquetEntity](filepath.Join(dir, "out.parquet"))
+	if err != nil || len(entities) != 1 || !strings.Contains(entities[0].Data, "first") {
+		t.Errorf("Expecting the entities of the first crawl to be kept, got %v %v", entities, err)
+	}
+	props, err := parquet.ReadFile[parquetProperty](filepath.Join(dir, "out_properties.parquet"))
+	if err != nil || len(props) != 1 || props[0].Value != "first" {
+		t.Errorf("Expecting the properties of the first crawl to be kept, got %v %v", props, err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.parquet")); len(files) != 4 {
+		t.Errorf("Expecting the second crawl on timestamped files but got %v", files)
+	}
+	if err := crawl("third", ExistsRefuse); err == nil {
+		t.Errorf("Expecting an error for existing files")
+	}
+}
+
+func TestAggregateSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aggregate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	u, _ := url.Parse("http://example.com/")
+	cw := &Crawler{BaseURL: u, CrawlID: "c1"}
+
+	var ds map[string]interface{}
+	json.Unmarshal([]byte(`{"@context":"http://schema.org","@graph":[{"@type":"Dataset","name":"Genes"},{"@type":["DataCatalog","Dataset"],"name":"Catalog"}]}`), &ds)
+	records := []Record{
+		{Page: "http://example.com/1", Extractor: ExtractorJSONLD, Status: 200, FetchedAt: time.Now(), Metadata: ds},
+		{Page: "http://example.com/2", Extractor: ExtractorJSONLD, Metadata: map[string]interface{}{"@type": "Person", "name": "Jane"}},
+		{Page: "http://example.com/1", Extractor: ExtractorJSONLD, Block: 1, Metadata: map[string]interface{}{"name": "Untyped"}},
+		{Page: "http://example.com/3", Extractor: ExtractorRDFa, Metadata: map[string]interface{}{"triples": []Triple{
+			{NewIRI("http://example.com/ds"), NewIRI(rdfType), NewIRI(schemaOrgVocab + "Dataset")},
+		}}},
+	}
+
+	write := func(group string) map[string]interface{} {
+		s := NewAggregateSink(cw, filepath.Join(dir, group+".json"), group)
+		if err := s.Open(); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range records {
+			if err := s.Write(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, group+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			t.Fatalf("Expecting a JSON document, got %s: %v", b, err)
+		}
+		if doc["crawl_id"] != "c1" || doc["seed"] != "http://example.com/" || doc["page_count"] != float64(3) || doc["record_count"] != float64(4) {
+			t.Errorf("Unexpected document header %s", b)
+		}
+		return doc
+	}
+
+	doc := write(GroupByPage)
+	pages, _ := doc["pages"].([]interface{})
+	if len(pages) != 3 {
+		t.Fatalf("Expecting 3 pages but got %v", doc["pages"])
+	}
+	p1 := pages[0].(map[string]interface{})
+	if p1["page"] != "http://example.com/1" || p1["status"] != float64(200) || len(p1["records"].([]interface{})) != 2 {
+		t.Errorf("Unexpected page %v", p1)
+	}
+
+	doc = write(GroupByType)
+	types, _ := doc["types"].(map[string]interface{})
+	counts := map[string]int{}
+	for t, es := range types {
+		counts[t] = len(es.([]interface{}))
+	}
+	if fmt.Sprint(counts) != "map[DataCatalog:1 Dataset:3 Person:1 Thing:1]" {
+		t.Errorf("Unexpected types %v", counts)
+	}
+
+	if _, err := NewSink("json", cw, map[string]string{"rotate": "10MB"}); err == nil {
+		t.Errorf("Expecting an error for a rotated document")
+	}
+
+	// a document that can not be written entirely is an error
+	if _, err := os.Stat("/dev/full"); err == nil {
+		s := NewAggregateSink(cw, "/dev/full", GroupByPage)
+		s.Output.Exists = ExistsOverwrite
+		if err := s.Open(); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range records {
+			s.Write(r)
+		}
+		if err := s.Close(); err == nil {
+			t.Errorf("Expecting an error writing to a full disk")
+		}
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var payloads []string
+	failures := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("X-Api-Key") != "abc" || r.Header.Get("Authorization") != "Bearer t0k" {
+			t.Errorf("Expecting the configured headers, got %v", r.Header)
+		}
+		if sig := r.Header.Get(SignatureHeader); sig != "sha256="+Sign("s3cret", b) {
+			t.Errorf("Unexpected signature %s", sig)
+		}
+		if strings.Contains(string(b), "reject") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if failures > 0 {
+			failures--
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		payloads = append(payloads, string(b))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	u, _ := url.Parse("http://example.com/")
+	cw := &Crawler{BaseURL: u, OutputFileName: filepath.Join(dir, "out.jsonl")}
+	s, err := NewSink("webhook", cw, map[string]string{"url": srv.URL, "token": "t0k", "secret": "s3cret", "headers": "X-Api-Key: abc", "batch": "2", "maxwait": "10ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.(*WebhookSink).RetryWait = time.Millisecond
+	s.Open()
+	start := time.Now()
+
+	s.Write(Record{Page: "http://example.com/1", Metadata: map[string]interface{}{"name": "A"}})
+	s.Write(Record{Page: "http://example.com/2", Metadata: map[string]interface{}{"name": "B"}})
+	s.Write(Record{Page: "http://example.com/3", Metadata: map[string]interface{}{"name": "reject"}})
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Expecting the rejected batch to be dead lettered, got %s", err)
+	}
+	s.Close()
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("Expecting the Retry-After wait to be capped")
+	}
+
+	if len(payloads) != 1 {
+		t.Fatalf("Expecting 1 delivered batch but got %d", len(payloads))
+	}
+	var p struct{ Records []Envelope }
+	if err := json.Unmarshal([]byte(payloads[0]), &p); err != nil || len(p.Records) != 2 || p.Records[1].Page != "http://example.com/2" {
+		t.Errorf("Unexpected payload %s", payloads[0])
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "out_deadletter.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(b), "\n") != 1 || !strings.Contains(string(b), "http://example.com/3") {
+		t.Errorf("Unexpected dead letter file %s", b)
+	}
+}
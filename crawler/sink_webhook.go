@@ -0,0 +1,212 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SignatureHeader is the header of the HMAC-SHA256 signature of the
+// webhook payloads, as sha256=<hex digest>.
+const SignatureHeader = "X-Signature-256"
+
+func init() {
+	RegisterSink("webhook", func(cw *Crawler, params map[string]string) (Sink, error) {
+		if params["url"] == "" {
+			return nil, fmt.Errorf("the webhook sink needs a url")
+		}
+		s := NewWebhookSink(params["url"])
+		s.Username = params["user"]
+		s.Password = params["password"]
+		s.Token = params["token"]
+		s.Secret = params["secret"]
+
+		if h := params["headers"]; h != "" {
+			for _, kv := range strings.Split(h, ";") {
+				p := strings.SplitN(kv, ":", 2)
+				if len(p) != 2 || strings.TrimSpace(p[0]) == "" {
+					return nil, fmt.Errorf("invalid webhook header %q, use Name:value", kv)
+				}
+				s.Headers.Set(strings.TrimSpace(p[0]), strings.TrimSpace(p[1]))
+			}
+		}
+
+		var err error
+		if v := params["batch"]; v != "" {
+			if s.BatchSize, err = strconv.Atoi(v); err != nil || s.BatchSize < 1 {
+				return nil, fmt.Errorf("invalid webhook batch size %q", v)
+			}
+		}
+		if err := retryParams(&s.Retry, "webhook", params); err != nil {
+			return nil, err
+		}
+
+		dl, ok := params["deadletter"]
+		if !ok {
+			dl = cw.outputBase() + "_deadletter.jsonl"
+		}
+		s.DeadLetter = dl
+		return s, nil
+	}, append([]string{"url", "headers", "user", "password", "token", "secret", "batch", "deadletter"}, retryKeys...)...)
+}
+
+// WebhookSink posts the envelopes of the records to an HTTP endpoint, in
+// batches sent as {"records": [...]}. Failed requests are retried as
+// set by Retry, batches that still fail are appended to
+// the DeadLetter JSON lines file, if set, to be sent again later. When
+// Secret is set every payload is signed with HMAC-SHA256 on the
+// SignatureHeader.
+type WebhookSink struct {
+	URL      string
+	Headers  http.Header
+	Username string
+	Password string
+	Token    string
+	Secret   string
+
+	// BatchSize is the number of records sent on each request.
+	BatchSize int
+	Retry
+	Client     *http.Client
+	DeadLetter string
+
+	batch      []json.RawMessage
+	deadLetter deadLetter
+	sent       int
+	failed     int
+}
+
+// NewWebhookSink creates a sink posting to the given URL.
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		URL:       url,
+		Headers:   http.Header{},
+		BatchSize: 100,
+		Retry:     DefaultRetry,
+		Client:    &http.Client{Timeout: time.Minute},
+	}
+}
+
+// Open resets the batch.
+func (s *WebhookSink) Open() error {
+	log.Info("Posting records to ", s.URL)
+	s.batch = nil
+	s.sent, s.failed = 0, 0
+	return nil
+}
+
+// Write adds the record to the batch, which is sent once it holds
+// BatchSize records.
+func (s *WebhookSink) Write(r Record) error {
+	b, err := json.Marshal(r.Envelope())
+	if err != nil {
+		return err
+	}
+	s.batch = append(s.batch, b)
+	if len(s.batch) >= s.BatchSize {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush sends the batch. A batch that can not be delivered is written to
+// the dead letter file, it is only an error when there is none.
+func (s *WebhookSink) Flush() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+	batch := s.batch
+	s.batch = nil
+
+	payload, err := json.Marshal(map[string]interface{}{"records": batch})
+	if err != nil {
+		return err
+	}
+	err = s.Retry.do("Webhook request", log.Fields{"URL": s.URL}, func() (bool, time.Duration, error) {
+		return s.post(payload)
+	})
+	if err == nil {
+		s.sent += len(batch)
+		return nil
+	}
+
+	s.failed += len(batch)
+	log.WithFields(log.Fields{
+		"URL":     s.URL,
+		"Records": len(batch),
+		"Error":   err,
+	}).Error("Webhook delivery failed")
+	if s.DeadLetter == "" {
+		return err
+	}
+	entries := make([][]byte, len(batch))
+	for i, b := range batch {
+		entries[i] = append(b, '\n')
+	}
+	return s.deadLetter.write(s.DeadLetter, "undelivered records", entries...)
+}
+
+// Close logs the delivery counts and closes the dead letter file.
+func (s *WebhookSink) Close() error {
+	log.WithFields(log.Fields{
+		"URL":    s.URL,
+		"Sent":   s.sent,
+		"Failed": s.failed,
+	}).Info("Webhook records delivered")
+	return s.deadLetter.close()
+}
+
+// post sends the payload once. It tells whether a failed request is
+// worth retrying, and how long the server asked to wait.
+func (s *WebhookSink) post(payload []byte) (bool, time.Duration, error) {
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, 0, err
+	}
+	for k, v := range s.Headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch {
+	case s.Token != "":
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	case s.Username != "":
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	if s.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(s.Secret, payload))
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return true, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("webhook request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+		return retryable(resp.StatusCode), retryAfter(resp.Header), err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return false, 0, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of a payload, as sent by the webhook
+// sink for receivers to check.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,591 @@
+package crawler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// turtleParser is a recursive descent parser for Turtle, the N-Triples
+// and N-Quads line formats are parsed with the same term readers.
+// TriG graph blocks are accepted but their graph names are dropped.
+type turtleParser struct {
+	in       string
+	pos      int
+	base     string
+	prefixes map[string]string
+	bn       *blankNodes
+	triples  []Triple
+}
+
+// RDFSyntaxError reports where an RDF document could not be parsed.
+type RDFSyntaxError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *RDFSyntaxError) Error() string {
+	return fmt.Sprintf("line %d column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+func parseTurtle(in string, base string, bn *blankNodes) (ts []Triple, err error) {
+	p := &turtleParser{in: in, base: base, prefixes: make(map[string]string), bn: bn}
+	defer p.recover(&err)
+
+	for {
+		p.skipWS()
+		if p.eof() {
+			break
+		}
+		p.statement()
+	}
+	return p.triples, nil
+}
+
+func parseNTriples(in string, bn *blankNodes) (ts []Triple, err error) {
+	p := &turtleParser{in: in, prefixes: make(map[string]string), bn: bn}
+	defer p.recover(&err)
+
+	for {
+		p.skipWS()
+		if p.eof() {
+			break
+		}
+		s := p.subject()
+		p.skipWS()
+		pr := NewIRI(p.iri())
+		p.skipWS()
+		o := p.object()
+		p.skipWS()
+		if !p.peekIs('.') {
+			// N-Quads graph label, not kept
+			p.subject()
+			p.skipWS()
+		}
+		p.expect('.')
+		p.emit(s, pr, o)
+	}
+	return p.triples, nil
+}
+
+func (p *turtleParser) recover(err *error) {
+	if r := recover(); r != nil {
+		se, ok := r.(*RDFSyntaxError)
+		if !ok {
+			panic(r)
+		}
+		*err = se
+	}
+}
+
+func (p *turtleParser) fail(format string, args ...interface{}) {
+	line := strings.Count(p.in[:p.pos], "\n") + 1
+	col := p.pos - strings.LastIndex(p.in[:p.pos], "\n")
+	panic(&RDFSyntaxError{Line: line, Column: col, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *turtleParser) emit(s, pr, o Term) {
+	p.triples = append(p.triples, Triple{s, pr, o})
+}
+
+func (p *turtleParser) eof() bool {
+	return p.pos >= len(p.in)
+}
+
+func (p *turtleParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.in[p.pos]
+}
+
+func (p *turtleParser) peekIs(c byte) bool {
+	return !p.eof() && p.in[p.pos] == c
+}
+
+func (p *turtleParser) hasPrefix(s string) bool {
+	return strings.HasPrefix(p.in[p.pos:], s)
+}
+
+func (p *turtleParser) hasKeyword(k string) bool {
+	if len(p.in)-p.pos < len(k) || !strings.EqualFold(p.in[p.pos:p.pos+len(k)], k) {
+		return false
+	}
+	if p.pos+len(k) < len(p.in) {
+		r, _ := utf8.DecodeRuneInString(p.in[p.pos+len(k):])
+		return !isNameChar(r) && r != ':'
+	}
+	return true
+}
+
+func (p *turtleParser) expect(c byte) {
+	p.skipWS()
+	if !p.peekIs(c) {
+		p.fail("expecting '%c'", c)
+	}
+	p.pos++
+}
+
+func (p *turtleParser) skipWS() {
+	for !p.eof() {
+		switch p.in[p.pos] {
+		case ' ', '\t', '\r', '\n':
+			p.pos++
+		case '#':
+			for !p.eof() && p.in[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *turtleParser) statement() {
+	switch {
+	case p.hasPrefix("@prefix"):
+		p.pos += len("@prefix")
+		p.prefixDecl()
+		p.expect('.')
+	case p.hasPrefix("@base"):
+		p.pos += len("@base")
+		p.skipWS()
+		p.base = p.iriRef()
+		p.expect('.')
+	case p.hasKeyword("PREFIX"):
+		p.pos += len("PREFIX")
+		p.prefixDecl()
+	case p.hasKeyword("BASE"):
+		p.pos += len("BASE")
+		p.skipWS()
+		p.base = p.iriRef()
+	case p.hasKeyword("GRAPH"):
+		p.pos += len("GRAPH")
+		p.skipWS()
+		p.subject()
+		p.graphBlock()
+	case p.peekIs('{'):
+		p.graphBlock()
+	default:
+		p.triplesStatement(true)
+	}
+}
+
+// graphBlock reads a TriG graph block, its triples are kept in the
+// default graph.
+func (p *turtleParser) graphBlock() {
+	p.expect('{')
+	for {
+		p.skipWS()
+		if p.peekIs('}') {
+			p.pos++
+			return
+		}
+		if p.eof() {
+			p.fail("unterminated graph block")
+		}
+		p.triplesStatement(false)
+	}
+}
+
+func (p *turtleParser) triplesStatement(dotRequired bool) {
+	var s Term
+	if p.peekIs('[') {
+		s = p.blankNodePropertyList()
+		p.skipWS()
+		if p.peekIs('.') || p.peekIs('}') {
+			p.endStatement(dotRequired)
+			return
+		}
+	} else {
+		s = p.subject()
+		p.skipWS()
+		if p.peekIs('{') {
+			// TriG graph name followed by its block
+			p.graphBlock()
+			return
+		}
+	}
+	p.predicateObjectList(s)
+	p.endStatement(dotRequired)
+}
+
+func (p *turtleParser) endStatement(dotRequired bool) {
+	p.skipWS()
+	if p.peekIs('.') {
+		p.pos++
+		return
+	}
+	if dotRequired || !p.peekIs('}') {
+		p.fail("expecting '.'")
+	}
+}
+
+func (p *turtleParser) prefixDecl() {
+	p.skipWS()
+	start := p.pos
+	for !p.eof() && p.in[p.pos] != ':' {
+		p.pos++
+	}
+	if p.eof() {
+		p.fail("invalid prefix declaration")
+	}
+	name := strings.TrimSpace(p.in[start:p.pos])
+	p.pos++
+	p.skipWS()
+	p.prefixes[name] = p.iriRef()
+}
+
+func (p *turtleParser) predicateObjectList(s Term) {
+	for {
+		p.skipWS()
+		pr := p.verb()
+		p.objectList(s, pr)
+		p.skipWS()
+		if !p.peekIs(';') {
+			return
+		}
+		for p.peekIs(';') {
+			p.pos++
+			p.skipWS()
+		}
+		if p.peekIs('.') || p.peekIs(']') || p.peekIs('}') || p.eof() {
+			return
+		}
+	}
+}
+
+func (p *turtleParser) objectList(s, pr Term) {
+	for {
+		p.skipWS()
+		p.emit(s, pr, p.object())
+		p.skipWS()
+		if !p.peekIs(',') {
+			return
+		}
+		p.pos++
+	}
+}
+
+func (p *turtleParser) verb() Term {
+	if p.peekIs('a') && p.pos+1 < len(p.in) {
+		r, _ := utf8.DecodeRuneInString(p.in[p.pos+1:])
+		if !isNameChar(r) && r != ':' {
+			p.pos++
+			return NewIRI(rdfType)
+		}
+	}
+	return NewIRI(p.iri())
+}
+
+func (p *turtleParser) subject() Term {
+	switch {
+	case p.hasPrefix("_:"):
+		return p.blankNodeLabel()
+	case p.peekIs('['):
+		return p.blankNodePropertyList()
+	case p.peekIs('('):
+		return p.collection()
+	}
+	return NewIRI(p.iri())
+}
+
+func (p *turtleParser) object() Term {
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.literal()
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return p.numericLiteral()
+	case p.hasKeyword("true"):
+		p.pos += 4
+		return NewLiteral("true", xsdBoolean, "")
+	case p.hasKeyword("false"):
+		p.pos += 5
+		return NewLiteral("false", xsdBoolean, "")
+	}
+	return p.subject()
+}
+
+func (p *turtleParser) blankNodeLabel() Term {
+	p.pos += 2
+	start := p.pos
+	for !p.eof() {
+		r, size := utf8.DecodeRuneInString(p.in[p.pos:])
+		if !isNameChar(r) && r != '.' {
+			break
+		}
+		p.pos += size
+	}
+	// a label can not end with a dot
+	for p.pos > start && p.in[p.pos-1] == '.' {
+		p.pos--
+	}
+	if p.pos == start {
+		p.fail("empty blank node label")
+	}
+	return p.bn.named(p.in[start:p.pos])
+}
+
+func (p *turtleParser) blankNodePropertyList() Term {
+	p.expect('[')
+	b := p.bn.fresh()
+	p.skipWS()
+	if p.peekIs(']') {
+		p.pos++
+		return b
+	}
+	p.predicateObjectList(b)
+	p.expect(']')
+	return b
+}
+
+func (p *turtleParser) collection() Term {
+	p.expect('(')
+	var items []Term
+	for {
+		p.skipWS()
+		if p.peekIs(')') {
+			p.pos++
+			break
+		}
+		if p.eof() {
+			p.fail("unterminated collection")
+		}
+		items = append(items, p.object())
+	}
+	return p.list(items)
+}
+
+// list emits the rdf:first/rdf:rest chain of a collection and returns its head.
+func (p *turtleParser) list(items []Term) Term {
+	return emitList(items, p.bn, p.emit)
+}
+
+func emitList(items []Term, bn *blankNodes, emit func(s, p, o Term)) Term {
+	if len(items) == 0 {
+		return NewIRI(rdfNil)
+	}
+	head := bn.fresh()
+	node := head
+	for i, it := range items {
+		emit(node, NewIRI(rdfFirst), it)
+		if i == len(items)-1 {
+			emit(node, NewIRI(rdfRest), NewIRI(rdfNil))
+		} else {
+			next := bn.fresh()
+			emit(node, NewIRI(rdfRest), next)
+			node = next
+		}
+	}
+	return head
+}
+
+func (p *turtleParser) iri() string {
+	if p.peekIs('<') {
+		return p.iriRef()
+	}
+	return p.prefixedName()
+}
+
+func (p *turtleParser) iriRef() string {
+	if !p.peekIs('<') {
+		p.fail("expecting IRI")
+	}
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.eof() {
+			p.fail("unterminated IRI")
+		}
+		c := p.in[p.pos]
+		if c == '>' {
+			p.pos++
+			break
+		}
+		if c == '\\' {
+			b.WriteRune(p.unicodeEscape())
+			continue
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+	return resolveIRI(p.base, b.String())
+}
+
+func (p *turtleParser) prefixedName() string {
+	start := p.pos
+	for !p.eof() && p.in[p.pos] != ':' {
+		r, size := utf8.DecodeRuneInString(p.in[p.pos:])
+		if !isNameChar(r) && r != '.' {
+			p.fail("unexpected character %q", r)
+		}
+		p.pos += size
+	}
+	if p.eof() {
+		p.fail("expecting prefixed name")
+	}
+	prefix := p.in[start:p.pos]
+	ns, ok := p.prefixes[prefix]
+	if !ok {
+		p.fail("undefined prefix %q", prefix)
+	}
+	p.pos++
+
+	var local strings.Builder
+	for !p.eof() {
+		r, size := utf8.DecodeRuneInString(p.in[p.pos:])
+		switch {
+		case r == '\\' && p.pos+1 < len(p.in):
+			local.WriteByte(p.in[p.pos+1])
+			p.pos += 2
+			continue
+		case r == '%' || r == ':' || r == '.' || isNameChar(r):
+			local.WriteRune(r)
+			p.pos += size
+			continue
+		}
+		break
+	}
+	l := local.String()
+	// a local name can not end with a dot
+	for strings.HasSuffix(l, ".") {
+		l = l[:len(l)-1]
+		p.pos--
+	}
+	return ns + l
+}
+
+func (p *turtleParser) literal() Term {
+	q := p.in[p.pos]
+	long := strings.Repeat(string(q), 3)
+	var value string
+	if p.hasPrefix(long) {
+		p.pos += 3
+		value = p.stringBody(long)
+	} else {
+		p.pos++
+		value = p.stringBody(string(q))
+	}
+
+	switch {
+	case p.peekIs('@'):
+		p.pos++
+		start := p.pos
+		for !p.eof() {
+			c := p.in[p.pos]
+			if !(c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+				break
+			}
+			p.pos++
+		}
+		return NewLiteral(value, "", p.in[start:p.pos])
+	case p.hasPrefix("^^"):
+		p.pos += 2
+		return NewLiteral(value, p.iri(), "")
+	}
+	return NewLiteral(value, "", "")
+}
+
+func (p *turtleParser) stringBody(end string) string {
+	var b strings.Builder
+	for {
+		if p.eof() {
+			p.fail("unterminated string")
+		}
+		if p.hasPrefix(end) {
+			p.pos += len(end)
+			return b.String()
+		}
+		c := p.in[p.pos]
+		if len(end) == 1 && (c == '\n' || c == '\r') {
+			p.fail("line break in string")
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			p.pos++
+			continue
+		}
+		if p.pos+1 >= len(p.in) {
+			p.fail("unterminated escape")
+		}
+		switch e := p.in[p.pos+1]; e {
+		case 't':
+			b.WriteByte('\t')
+		case 'b':
+			b.WriteByte('\b')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case '"', '\'', '\\':
+			b.WriteByte(e)
+		case 'u', 'U':
+			b.WriteRune(p.unicodeEscape())
+			continue
+		default:
+			p.fail("invalid escape \\%c", e)
+		}
+		p.pos += 2
+	}
+}
+
+func (p *turtleParser) unicodeEscape() rune {
+	if p.pos+1 >= len(p.in) {
+		p.fail("unterminated escape")
+	}
+	n := 4
+	switch p.in[p.pos+1] {
+	case 'u':
+	case 'U':
+		n = 8
+	default:
+		p.fail("invalid escape \\%c", p.in[p.pos+1])
+	}
+	if p.pos+2+n > len(p.in) {
+		p.fail("unterminated escape")
+	}
+	v, err := strconv.ParseUint(p.in[p.pos+2:p.pos+2+n], 16, 32)
+	if err != nil {
+		p.fail("invalid unicode escape")
+	}
+	p.pos += 2 + n
+	return rune(v)
+}
+
+func (p *turtleParser) numericLiteral() Term {
+	start := p.pos
+	if p.peekIs('+') || p.peekIs('-') {
+		p.pos++
+	}
+	datatype := xsdInteger
+digits:
+	for !p.eof() {
+		c := p.in[p.pos]
+		switch {
+		case c >= '0' && c <= '9':
+		case c == '.' && datatype == xsdInteger && p.pos+1 < len(p.in) && p.in[p.pos+1] >= '0' && p.in[p.pos+1] <= '9':
+			datatype = xsdDecimal
+		case (c == 'e' || c == 'E') && datatype != xsdDouble:
+			datatype = xsdDouble
+			if p.pos+1 < len(p.in) && (p.in[p.pos+1] == '+' || p.in[p.pos+1] == '-') {
+				p.pos++
+			}
+		default:
+			break digits
+		}
+		p.pos++
+	}
+	if p.pos == start || p.in[start:p.pos] == "+" || p.in[start:p.pos] == "-" {
+		p.fail("invalid number")
+	}
+	return NewLiteral(p.in[start:p.pos], datatype, "")
+}
+
+func isNameChar(r rune) bool {
+	return r == '_' || r == '-' || r == 0xB7 || unicode.IsLetter(r) || unicode.IsDigit(r)
+}